@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	ms "github.com/cheahjs/monzosplitwise"
+	"github.com/cheahjs/monzosplitwise/monzo"
+	"github.com/cheahjs/monzosplitwise/splitwise"
+)
+
+// defaultCategories maps Monzo categories to Splitwise category IDs. Run the
+// categories command for the names of the Splitwise categories.
+var defaultCategories = map[string]int{
+	"bills":         11, // Utilities - Other
+	"cash":          18, // Uncategorized - General
+	"charity":       44, // Life - Other
+	"eating_out":    13, // Food and drink - Dining out
+	"entertainment": 23, // Entertainment - Other
+	"expenses":      18, // Uncategorized - General
+	"family":        44, // Life - Other
+	"general":       18, // Uncategorized - General
+	"gifts":         42, // Life - Gifts
+	"groceries":     12, // Food and drink - Groceries
+	"holidays":      47, // Transportation - Hotel
+	"personal_care": 44, // Life - Other
+	"shopping":      14, // Home - Household supplies
+	"transport":     34, // Transportation - Other
+}
+
+// expenseCategory returns the Splitwise category ID for a transaction, from
+// its Monzo category or otherwise its merchant's category, or zero if neither
+// is mapped. Mappings in the group's config take precedence over the defaults.
+func expenseCategory(tnx monzo.Transaction, groupConfig ms.GroupConfig) int {
+	for _, category := range []string{tnx.Category, tnx.Merchant.Category} {
+		if category == "" {
+			continue
+		}
+		if id, ok := groupConfig.Categories[category]; ok {
+			return id
+		}
+		if id, ok := defaultCategories[category]; ok {
+			return id
+		}
+	}
+	return 0
+}
+
+// printCategories prints the Splitwise categories and their IDs.
+func printCategories(config ms.Config) error {
+	categories, err := splitwise.NewClient(context.Background(), config.Splitwise).GetCategories()
+	if err != nil {
+		return err
+	}
+	for _, category := range categories {
+		fmt.Println(category.Name)
+		for _, subcategory := range category.Subcategories {
+			fmt.Printf("  %v: %v\n", subcategory.ID, subcategory.Name)
+		}
+	}
+	return nil
+}
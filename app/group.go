@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	ms "github.com/cheahjs/monzosplitwise"
+	"github.com/cheahjs/monzosplitwise/splitwise"
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxSuggestions is the most group names suggested for an unknown tag
+const maxSuggestions = 3
+
+// findGroup returns the group a tag refers to. Aliases configured with a
+// group ID take precedence over matching the group's name.
+func findGroup(groups []splitwise.Group, configs map[string]ms.GroupConfig, name string) (*splitwise.Group, error) {
+	groupConfig, ok := findGroupConfig(configs, name)
+	if !ok || groupConfig.ID == 0 {
+		return findGroupByName(groups, name)
+	}
+	for _, v := range groups {
+		if v.ID == groupConfig.ID {
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("no group found with ID %v for %v", groupConfig.ID, name)
+}
+
+// findGroupConfig returns the settings for a group name or alias used in a
+// tag. Keys are normalised like group names, so "Flat!" finds "flat".
+func findGroupConfig(configs map[string]ms.GroupConfig, name string) (ms.GroupConfig, bool) {
+	normName := normalizeName(name)
+	if normName == "" {
+		return ms.GroupConfig{}, false
+	}
+	for key, groupConfig := range configs {
+		if normalizeName(key) == normName {
+			return groupConfig, true
+		}
+	}
+	return ms.GroupConfig{}, false
+}
+
+// validateGroups checks that no two group settings are for the same tag.
+func validateGroups(configs map[string]ms.GroupConfig) error {
+	keys := map[string]string{}
+	for key := range configs {
+		normKey := normalizeName(key)
+		if normKey == "" {
+			return fmt.Errorf("group setting %q has no letters or digits to tag it with", key)
+		}
+		if other, ok := keys[normKey]; ok {
+			return fmt.Errorf("group settings %q and %q are for the same tag", other, key)
+		}
+		keys[normKey] = key
+	}
+	return nil
+}
+
+// findGroupByName returns the only group whose normalised name matches name.
+// If no group matches, the closest names are suggested.
+func findGroupByName(groups []splitwise.Group, name string) (*splitwise.Group, error) {
+	normName := normalizeName(name)
+	var found []splitwise.Group
+	for _, v := range groups {
+		if v.ID != 0 && normName != "" && groupTagName(v) == normName {
+			found = append(found, v)
+		}
+	}
+	switch len(found) {
+	case 0:
+		suggestions := suggestGroups(groups, normName)
+		if len(suggestions) == 0 {
+			return nil, fmt.Errorf("no group called %v", name)
+		}
+		return nil, fmt.Errorf("no group called %v, did you mean %v?", name, strings.Join(suggestions, " or "))
+	case 1:
+		return &found[0], nil
+	}
+	var names []string
+	for _, v := range found {
+		names = append(names, fmt.Sprintf("%q (%v)", v.Name, v.ID))
+	}
+	return nil, fmt.Errorf("%v matches more than one group: %v; configure an alias with the group ID",
+		name, strings.Join(names, ", "))
+}
+
+// suggestGroups returns the tag names of the groups closest to name, closest first.
+func suggestGroups(groups []splitwise.Group, name string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+	for _, v := range groups {
+		tagName := groupTagName(v)
+		if v.ID == 0 || tagName == "" {
+			continue
+		}
+		distance := levenshtein(name, tagName)
+		// Allow roughly one mistake for every three characters
+		if distance <= len([]rune(tagName))/3+1 {
+			candidates = append(candidates, candidate{tagName, distance})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+	var suggestions []string
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, tagPrefix+"-"+candidates[i].name)
+	}
+	return suggestions
+}
+
+// groupTagName is the name a group can be tagged with if it has no alias
+func groupTagName(group splitwise.Group) string {
+	return normalizeName(group.Name)
+}
+
+// normalizeName lowercases name and strips accents, leaving only letters and
+// digits, so "Flat 22 🏠" and "Café-Club" can be tagged as "flat22" and "cafeclub".
+func normalizeName(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// levenshtein returns the number of single character edits between a and b.
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(br)]
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, v := range values[1:] {
+		if v < result {
+			result = v
+		}
+	}
+	return result
+}
+
+// printGroups prints the tag that each Splitwise group is added to with.
+func printGroups(config ms.Config) error {
+	groups, err := splitwise.NewClient(context.Background(), config.Splitwise).GetGroups()
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if group.ID == 0 {
+			// Non-group expenses
+			continue
+		}
+		var tags []string
+		for alias, groupConfig := range config.Groups {
+			if groupConfig.ID == group.ID {
+				tags = append(tags, tagPrefix+"-"+alias)
+			}
+		}
+		// The name only works if no alias or other group takes it over
+		name := groupTagName(group)
+		if found, err := findGroup(groups, config.Groups, name); err == nil && found.ID == group.ID {
+			tags = append(tags, tagPrefix+"-"+name)
+		}
+		sort.Strings(tags)
+		if len(tags) == 0 {
+			tags = append(tags, "(no tag)")
+		}
+		fmt.Printf("%v (%v): %v\n", group.Name, group.ID, strings.Join(tags, ", "))
+	}
+	for alias, groupConfig := range config.Groups {
+		if groupConfig.ID == 0 {
+			continue
+		}
+		if _, err := findGroup(groups, config.Groups, alias); err != nil {
+			fmt.Printf("%v-%v: %v\n", tagPrefix, alias, err)
+		}
+	}
+	return nil
+}
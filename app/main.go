@@ -1,11 +1,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
-	"sync"
 	"time"
 
 	ms "github.com/cheahjs/monzosplitwise"
@@ -13,9 +14,19 @@ import (
 	"github.com/cheahjs/monzosplitwise/splitwise"
 )
 
+// dateFormat is the format of dates given on the command line
+const dateFormat = "2006-01-02"
+
 func main() {
 	fmt.Println("Starting MonzoSplitwise.")
 
+	// Command defaults to a single sync run
+	command := "sync"
+	args := os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
 	// Config loading
 	fmt.Println("Loading config.json.")
 	config, err := readConfig()
@@ -44,193 +55,179 @@ func main() {
 		var code2 string
 		_, err = fmt.Scanf("%s\n", &code2)
 		checkError(err)
-		client, err := monzo.ExchangeAuth(config.Monzo.ClientID, config.Monzo.ClientSecret, "http://localhost/", code+code2)
+		client := monzo.MonzoClient(config.Monzo)
+		err = client.ExchangeAuth(context.Background(), "http://localhost/", code+code2)
 		checkError(err)
-		config.Monzo = monzo.MonzoConfig(*client)
+		config.Monzo = monzo.MonzoConfig(client)
 		saveConfig(config)
 	}
-	runJob(config)
+
+	switch command {
+	case "sync":
+		flags := flag.NewFlagSet("sync", flag.ExitOnError)
+		dryRun := flags.Bool("dry-run", false, "print expenses instead of adding them to Splitwise")
+		flags.Parse(args)
+		runJob(config, *dryRun)
+	case "backfill":
+		flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+		from := flags.String("from", "", "first day to sync, as YYYY-MM-DD")
+		to := flags.String("to", "", "last day to sync, as YYYY-MM-DD (default today)")
+		dryRun := flags.Bool("dry-run", false, "print expenses instead of adding them to Splitwise")
+		flags.Parse(args)
+		fromDate, toDate, err := parseDateRange(*from, *to)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		runBackfill(config, fromDate, toDate, *dryRun)
+	case "repush":
+		if len(args) != 1 {
+			fmt.Println("Usage: repush <monzo transaction ID>")
+			os.Exit(2)
+		}
+		checkError(repushTransaction(config, args[0]))
+	case "groups":
+		checkError(printGroups(config))
+	case "categories":
+		checkError(printCategories(config))
+	case "failures":
+		checkError(printFailures(config))
+	case "serve":
+		flags := flag.NewFlagSet("serve", flag.ExitOnError)
+		addr := flags.String("addr", ":8080", "address to listen on for Monzo webhooks")
+		path := flags.String("path", "/webhook", "URL path that Monzo webhooks are posted to")
+		flags.Parse(args)
+		checkError(serveWebhooks(*addr, *path))
+	case "webhooks":
+		flags := flag.NewFlagSet("webhooks", flag.ExitOnError)
+		webhookURL := flags.String("url", "", "public URL that Monzo webhooks should be sent to")
+		flags.Parse(args)
+		if *webhookURL == "" {
+			fmt.Println("A webhook URL must be provided with -url")
+			os.Exit(2)
+		}
+		checkError(ensureWebhook(&config, *webhookURL))
+	default:
+		fmt.Println("Unknown command:", command)
+		os.Exit(2)
+	}
+}
+
+// parseDateRange parses the days given to backfill, returning the start of
+// from and the end of to.
+func parseDateRange(from, to string) (time.Time, time.Time, error) {
+	if from == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("a start date must be provided with -from")
+	}
+	fromDate, err := time.ParseInLocation(dateFormat, from, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid -from date: %v", err)
+	}
+	toDate := time.Now()
+	if to != "" {
+		toDate, err = time.ParseInLocation(dateFormat, to, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid -to date: %v", err)
+		}
+		toDate = toDate.AddDate(0, 0, 1)
+	}
+	if !fromDate.Before(toDate) {
+		return time.Time{}, time.Time{}, fmt.Errorf("-from must be before -to")
+	}
+	return fromDate, toDate, nil
 }
 
 func checkError(err error) {
 	if err != nil {
+		explainError(err)
 		panic(err)
 	}
 }
 
-func runJob(config ms.Config) {
-	var wg sync.WaitGroup
-
-	// Check for Monzo/Splitwise transactions for the past 15 days
-	dateSince := time.Now().Add(time.Duration(-15*24) * time.Hour).Format(time.RFC3339)
+// explainError prints what can be done about errors from Monzo.
+func explainError(err error) {
+	apiErr, ok := err.(*monzo.APIError)
+	switch {
+	case !ok:
+	case apiErr.IsForbidden():
+		fmt.Println("Monzo refused access. Approve access for the app in the Monzo app, then try again.")
+	case apiErr.IsRateLimited():
+		fmt.Println("Too many requests have been made to Monzo. Try again later.")
+	case apiErr.IsServerError():
+		fmt.Println("Monzo is having problems. Try again later.")
+	}
+}
 
+// authenticateMonzo returns a Monzo client for config, refreshing and saving
+// the access token if it has expired.
+func authenticateMonzo(ctx context.Context, config *ms.Config) (*monzo.MonzoClient, error) {
 	monzoClient := monzo.MonzoClient(config.Monzo)
-	var transactions []monzo.Transaction
-	var tagged []taggedTransaction
-	// Monzo work
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		// Refresh token if expired
-		if !monzoClient.Authenticated() {
-			err := monzoClient.RefreshAccessToken()
-			checkError(err)
-			config.Monzo = monzo.MonzoConfig(monzoClient)
-			err = saveConfig(config)
-			checkError(err)
-		}
-
-		// Get account to use, prefer CA over PP
-		accounts, err := monzoClient.Accounts()
-		checkError(err)
-		account := accounts[0]
-		for _, v := range accounts {
-			if v.Type == "uk_retail" {
-				account = v
-			}
-		}
-
-		// Get transactions, 100 transactions and 15 days should be long enough
-		// to get all transactions within context
-		// This will break if we've made more than 100 transactions in 15 days.
-		// TODO: Support pagination
-		transactions, err = monzoClient.Transactions(
-			account.ID,
-			dateSince,
-			"", 100)
-		checkError(err)
-		fmt.Printf("Fetched %v transactions\n", len(transactions))
-		if len(transactions) >= 100 {
-			fmt.Println("100 transactions fetched, might be missing some newer transactions!")
-		}
-
-		// Find transactions with #splitwise as note
-		tagged = getTaggedTransactions(transactions)
-	}()
-
-	var curUser splitwise.User
-	var expenses []splitwise.Expense
-	var groups []splitwise.Group
-
-	// Splitwise work
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		// Get current Splitwise user
-                currentUser, err := splitwise.GetCurrentUser(config.Splitwise)
-                checkError(err)
-                curUser = *currentUser
-                fmt.Println("Logged in as Splitwise user", curUser.Email)
-	}()
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		var err error
-		// Get Splitwise groups
-		groups, err = splitwise.GetGroups(config.Splitwise)
-		checkError(err)
-		fmt.Printf("Fetched %v groups\n", len(groups))
-                // Get Splitwise expenses
-                expenses, err = splitwise.GetExpenses(config.Splitwise, "", dateSince, 100)
-                checkError(err)
-                fmt.Printf("Fetched %v expenses\n", len(expenses))
-                for _, grp := range groups {
-                        group_expenses, err := splitwise.GetExpenses(config.Splitwise, fmt.Sprintf("%d", grp.ID), dateSince, 100)
-                        checkError(err)
-                        fmt.Printf("Fetched %v expenses for %v\n", len(group_expenses), grp.Name)
-                        expenses = append(expenses, group_expenses...)
-//                      fmt.Println(expenses)
-                }
-	}()
-
-	// Wait for all work to be done
-	wg.Wait()
-
-	for _, v := range tagged {
-		tag := v.Tag
-		tnx := v.Transaction
-
-		// Check if expense already exists
-		exists := false
-		for _, exp := range expenses {
-			if strings.Contains(exp.Details, tnx.ID) {
-				exists = true
-				break
-			}
-		}
-		if exists {
-			continue
+	if !monzoClient.Authenticated() {
+		err := monzoClient.RefreshAccessToken(ctx)
+		if err != nil {
+			return nil, err
 		}
-
-		var groupID string
-		var groupName string
-		var groupUsers []string
-
-		// Get group ID
-		switch strings.ToLower(tag) {
-		case "#splitwise", "#splitwise-":
-			groupID = "0"
-			groupName = "Non-group expenses"
-			groupUsers = append(groupUsers, fmt.Sprintf("%v", curUser.ID))
-		default:
-			groupName = strings.SplitN(tag, "-", 2)[1]
-			group, err := findGroupByName(groups, groupName)
-			if err != nil {
-				fmt.Println("Group not found:", groupName)
-				continue
-			}
-			groupID = fmt.Sprintf("%v", group.ID)
-			for _, member := range group.Members {
-				groupUsers = append(groupUsers, fmt.Sprintf("%v", member.ID))
-			}
+		config.Monzo = monzo.MonzoConfig(monzoClient)
+		err = saveConfig(*config)
+		if err != nil {
+			return nil, err
 		}
-		fmt.Println("Adding expense to group", groupName)
-		expense, err := splitwise.AddExpense(
-			config.Splitwise, "false", tnx.Amount, tnx.Currency, tnx.Merchant.Name,
-			groupID, fmt.Sprintf("MonzoTransaction:%v", tnx.ID), tnx.Created,
-			"split", fmt.Sprintf("%v", curUser.ID), groupUsers)
-		checkError(err)
-		fmt.Println("Added expense:")
-		fmt.Println(expense)
 	}
-
-	fmt.Println("Done")
+	return &monzoClient, nil
 }
 
-func findGroupByName(groups []splitwise.Group, name string) (*splitwise.Group, error) {
-	normName := strings.ToLower(name)
-	for _, v := range groups {
-		groupName := strings.ToLower(strings.Replace(v.Name, " ", "", -1))
-		if groupName == normName {
-			return &v, nil
+// selectAccount picks the account to sync, preferring the current account over
+// the prepaid account.
+func selectAccount(accounts []monzo.Account) monzo.Account {
+	account := accounts[0]
+	for _, v := range accounts {
+		if v.Type == "uk_retail" {
+			account = v
 		}
 	}
-	return nil, fmt.Errorf("No group found")
+	return account
 }
 
 type taggedTransaction struct {
 	Transaction monzo.Transaction
 	Tag         string
+	// FromRule is set when the tag came from a rule rather than the notes
+	FromRule bool
 }
 
-func getTaggedTransactions(transactions []monzo.Transaction) []taggedTransaction {
+// getTaggedTransactions returns transactions with a #splitwise tag in their
+// notes or matching a rule.
+func getTaggedTransactions(transactions []monzo.Transaction, rules []ms.Rule) []taggedTransaction {
 	var tagged []taggedTransaction
 	for _, v := range transactions {
-		if v.Amount > 0 {
-			// ignore credit transactions
-			continue
+		if tag, fromRule := transactionTag(v, rules); tag != "" {
+			tagged = append(tagged, taggedTransaction{v, tag, fromRule})
+		}
+	}
+	return tagged
+}
+
+// getUntagged returns transactions without a #splitwise tag or matching rule.
+func getUntagged(transactions []monzo.Transaction, rules []ms.Rule) []monzo.Transaction {
+	var untagged []monzo.Transaction
+	for _, v := range transactions {
+		if tag, _ := transactionTag(v, rules); tag == "" {
+			untagged = append(untagged, v)
 		}
-		notes := v.Notes
-		fields := strings.Fields(notes)
+	}
+	return untagged
+}
 
-		for _, field := range fields {
-			if strings.Contains(field, "#splitwise") {
-				tagged = append(tagged, taggedTransaction{v, field})
-				break
-			}
+// getUntaggedRefunds returns credits from merchants that have no #splitwise tag.
+func getUntaggedRefunds(transactions []monzo.Transaction) []monzo.Transaction {
+	var refunds []monzo.Transaction
+	for _, v := range transactions {
+		if v.Amount <= 0 || v.IsLoad || v.Merchant.ID == "" || strings.Contains(v.Notes, "#splitwise") {
+			continue
 		}
+		refunds = append(refunds, v)
 	}
-	return tagged
+	return refunds
 }
 
 func readConfig() (ms.Config, error) {
@@ -247,7 +244,16 @@ func readConfig() (ms.Config, error) {
 		if err != nil {
 			return config, err
 		}
-		return config, err
+		if config.StatePath == "" {
+			config.StatePath = ms.DefaultStatePath
+		}
+		if config.Sync.Overlap == "" {
+			config.Sync.Overlap = ms.DefaultSyncOverlap
+		}
+		if err := validateGroups(config.Groups); err != nil {
+			return config, err
+		}
+		return config, validateRules(config.Rules)
 	}
 	// config.json does not exist, create and return error
 	err := saveConfig(ms.GetDefaultConfig())
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	ms "github.com/cheahjs/monzosplitwise"
+	"github.com/cheahjs/monzosplitwise/monzo"
+)
+
+// transactionTag returns the #splitwise tag in a transaction's notes, or
+// otherwise the tag of the first rule it matches, and whether the tag came
+// from a rule. Top ups are never tagged.
+func transactionTag(tnx monzo.Transaction, rules []ms.Rule) (string, bool) {
+	if tnx.IsLoad {
+		return "", false
+	}
+	for _, field := range strings.Fields(tnx.Notes) {
+		if strings.Contains(field, tagPrefix) {
+			return field, false
+		}
+	}
+	for _, rule := range rules {
+		if matchRule(rule, tnx) {
+			return rule.Tag, true
+		}
+	}
+	return "", false
+}
+
+// matchRule reports whether a transaction matches all of a rule's conditions.
+// Only money going out matches, as refunds are handled separately.
+func matchRule(rule ms.Rule, tnx monzo.Transaction) bool {
+	if tnx.Amount >= 0 {
+		return false
+	}
+	amount := -tnx.Amount
+	if rule.MinAmount != 0 && amount < rule.MinAmount {
+		return false
+	}
+	if rule.MaxAmount != 0 && amount > rule.MaxAmount {
+		return false
+	}
+	if rule.Merchant != "" && rule.Merchant != tnx.Merchant.ID &&
+		(tnx.Merchant.Name == "" || !strings.EqualFold(rule.Merchant, tnx.Merchant.Name)) {
+		return false
+	}
+	if rule.Category != "" && !strings.EqualFold(rule.Category, tnx.Category) {
+		return false
+	}
+	if rule.Description != "" &&
+		!strings.Contains(strings.ToLower(tnx.Description), strings.ToLower(rule.Description)) {
+		return false
+	}
+	if rule.Counterparty != "" {
+		c := tnx.Counterparty
+		if !strings.EqualFold(rule.Counterparty, c.Name) &&
+			rule.Counterparty != c.AccountNumber && rule.Counterparty != c.UserID {
+			return false
+		}
+	}
+	return true
+}
+
+// validateRules checks that every rule has a condition and a tag that can be
+// synced. A rule without conditions would match every payment, which is most
+// likely a misspelled condition.
+func validateRules(rules []ms.Rule) error {
+	for i, rule := range rules {
+		if rule.Merchant == "" && rule.Category == "" && rule.Description == "" &&
+			rule.Counterparty == "" && rule.MinAmount == 0 && rule.MaxAmount == 0 {
+			return fmt.Errorf("rule %v: at least one of Merchant, Category, Description, Counterparty, MinAmount or MaxAmount must be set", i+1)
+		}
+		if !strings.HasPrefix(rule.Tag, tagPrefix) {
+			return fmt.Errorf("rule %v: tag %q must start with %v", i+1, rule.Tag, tagPrefix)
+		}
+		if rule.MaxAmount != 0 && rule.MaxAmount < rule.MinAmount {
+			return fmt.Errorf("rule %v: MaxAmount is less than MinAmount", i+1)
+		}
+	}
+	return nil
+}
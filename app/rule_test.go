@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	ms "github.com/cheahjs/monzosplitwise"
+)
+
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		rule    ms.Rule
+		wantErr bool
+	}{
+		{ms.Rule{Merchant: "Ocado", Tag: "#splitwise-flat"}, false},
+		{ms.Rule{Category: "bills", Tag: "#splitwise-flat=2:1:1"}, false},
+		{ms.Rule{Description: "netflix", Tag: "#splitwise"}, false},
+		{ms.Rule{Counterparty: "Octopus Energy", Tag: "#splitwise-flat"}, false},
+		{ms.Rule{MinAmount: 5000, Tag: "#splitwise-flat"}, false},
+		{ms.Rule{MaxAmount: 5000, Tag: "#splitwise-flat"}, false},
+		// A rule without conditions would match every payment
+		{ms.Rule{Tag: "#splitwise-flat"}, true},
+		{ms.Rule{Merchant: "Ocado"}, true},
+		{ms.Rule{Merchant: "Ocado", Tag: "splitwise-flat"}, true},
+		{ms.Rule{Merchant: "Ocado", Tag: "#Splitwise-flat"}, true},
+		{ms.Rule{MinAmount: 5000, MaxAmount: 1000, Tag: "#splitwise-flat"}, true},
+	}
+	for _, test := range tests {
+		err := validateRules([]ms.Rule{test.rule})
+		if (err != nil) != test.wantErr {
+			t.Errorf("validateRules(%+v) error = %v, want error %v", test.rule, err, test.wantErr)
+		}
+	}
+}
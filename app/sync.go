@@ -0,0 +1,1063 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ms "github.com/cheahjs/monzosplitwise"
+	"github.com/cheahjs/monzosplitwise/monzo"
+	"github.com/cheahjs/monzosplitwise/splitwise"
+	"github.com/cheahjs/monzosplitwise/state"
+)
+
+// unsettledLimit is how long after being created transactions are checked
+// for settling at a different amount, if they aren't fetched by a sync
+const unsettledLimit = 30 * 24 * time.Hour
+
+// syncer adds tagged transactions to Splitwise, using everything fetched
+// from Splitwise for the run.
+type syncer struct {
+	ctx             context.Context
+	config          ms.Config
+	store           *state.Store
+	monzoClient     *monzo.MonzoClient
+	splitwiseClient *splitwise.Client
+	curUser         splitwise.User
+	groups          []splitwise.Group
+	friends         []splitwise.Friend
+	expenses        []splitwise.Expense
+	// dryRun prints expenses instead of adding them to Splitwise
+	dryRun bool
+	// interactive is set when changes can be confirmed on the terminal
+	interactive bool
+}
+
+func runJob(config ms.Config, dryRun bool) {
+	store, err := state.Open(config.StatePath)
+	checkError(err)
+	defer store.Close()
+
+	// Check for Monzo/Splitwise transactions since the last run
+	since, err := syncSince(config, store)
+	checkError(err)
+	transactions := runSync(config, store, since, time.Time{}, dryRun)
+	if dryRun {
+		fmt.Println("Done")
+		return
+	}
+
+	// Resume from the newest transaction next time
+	cursor, err := latestCreated(transactions)
+	checkError(err)
+	if !cursor.IsZero() {
+		err = store.SetCursor(cursor)
+		checkError(err)
+	}
+
+	fmt.Println("Done")
+}
+
+// runBackfill syncs every tagged transaction created between from and to,
+// without moving the sync cursor.
+func runBackfill(config ms.Config, from, to time.Time, dryRun bool) {
+	store, err := state.Open(config.StatePath)
+	checkError(err)
+	defer store.Close()
+
+	runSync(config, store, from, to, dryRun)
+
+	fmt.Println("Done")
+}
+
+// runSync adds tagged transactions created after since, and before before if
+// it is set, to Splitwise. All transactions fetched from Monzo are returned.
+// If dryRun is set, expenses are printed instead of being added.
+func runSync(config ms.Config, store *state.Store, since, before time.Time, dryRun bool) []monzo.Transaction {
+	var wg sync.WaitGroup
+	ctx := context.Background()
+
+	dateSince := since.Format(time.RFC3339)
+	dateBefore := ""
+	if !before.IsZero() {
+		dateBefore = before.Format(time.RFC3339)
+	}
+	fmt.Println("Syncing transactions since", dateSince)
+
+	var monzoClient *monzo.MonzoClient
+	var account monzo.Account
+	var transactions []monzo.Transaction
+	var tagged []taggedTransaction
+	// Monzo work
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var err error
+		// Refresh token if expired
+		monzoClient, err = authenticateMonzo(ctx, &config)
+		checkError(err)
+
+		// Get account to use, prefer CA over PP
+		accounts, err := monzoClient.Accounts(ctx)
+		checkError(err)
+		account = selectAccount(accounts)
+
+		// Get all transactions within context, paginating as needed
+		transactions, err = monzoClient.AllTransactions(ctx, account.ID, dateSince, dateBefore)
+		checkError(err)
+		fmt.Printf("Fetched %v transactions\n", len(transactions))
+
+		// Find transactions with #splitwise as note, or matching a rule
+		tagged = getTaggedTransactions(transactions, config.Rules)
+	}()
+
+	var curUser splitwise.User
+	var expenses []splitwise.Expense
+	var groups []splitwise.Group
+	var friends []splitwise.Friend
+	splitwiseClient := splitwise.NewClient(ctx, config.Splitwise)
+
+	// Splitwise work
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Get current Splitwise user
+		currentUser, err := splitwiseClient.GetCurrentUser()
+		checkError(err)
+		curUser = *currentUser
+		fmt.Println("Logged in as Splitwise user", curUser.Email)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var err error
+		// Get Splitwise groups
+		groups, err = splitwiseClient.GetGroups()
+		checkError(err)
+		fmt.Printf("Fetched %v groups\n", len(groups))
+		// Get Splitwise friends
+		friends, err = splitwiseClient.GetFriends()
+		checkError(err)
+		fmt.Printf("Fetched %v friends\n", len(friends))
+		// Get Splitwise expenses
+		expenses, err = getExpenses(splitwiseClient, groups, dateSince, dateBefore)
+		checkError(err)
+	}()
+
+	// Wait for all work to be done
+	wg.Wait()
+
+	s := &syncer{
+		ctx:             ctx,
+		config:          config,
+		store:           store,
+		monzoClient:     monzoClient,
+		splitwiseClient: splitwiseClient,
+		curUser:         curUser,
+		groups:          groups,
+		friends:         friends,
+		expenses:        expenses,
+		dryRun:          dryRun,
+		// Runs from the command line can ask for confirmation
+		interactive: true,
+	}
+	// A transaction that fails to sync shouldn't stop the others
+	for _, v := range tagged {
+		if err := s.syncTransaction(v); err != nil {
+			s.tagFailed(v.Transaction, v.Tag, err.Error())
+		}
+	}
+	for _, tnx := range getUntagged(transactions, config.Rules) {
+		if err := s.removeUntagged(tnx); err != nil {
+			s.tagFailed(tnx, "", fmt.Sprintf("Failed to remove expense: %v", err))
+		}
+	}
+	if config.Sync.LinkRefunds {
+		for _, tnx := range getUntaggedRefunds(transactions) {
+			if err := s.syncLinkedRefund(tnx); err != nil {
+				s.tagFailed(tnx, "", fmt.Sprintf("Failed to add refund: %v", err))
+			}
+		}
+	}
+	s.syncOutstanding(account.ID, transactions)
+
+	return transactions
+}
+
+// syncOutstanding syncs transactions that weren't fetched by this sync but
+// whose expenses may still need to change, as they hadn't settled when they
+// were synced, or that failed to sync. Authorisations such as hotels and fuel
+// can take days to settle, and failures are retried until they are fixed.
+func (s *syncer) syncOutstanding(accountID string, fetched []monzo.Transaction) {
+	seen := map[string]bool{}
+	for _, tnx := range fetched {
+		seen[tnx.ID] = true
+	}
+	// Tags of the outstanding transactions, by transaction ID
+	outstanding := map[string]string{}
+	var ids []string
+	records, err := s.store.FindUnsettled(time.Now().Add(-unsettledLimit))
+	if err != nil {
+		fmt.Println("Failed to find unsettled transactions:", err)
+	}
+	for _, record := range records {
+		if !seen[record.TransactionID] {
+			seen[record.TransactionID] = true
+			outstanding[record.TransactionID] = record.Tag
+			ids = append(ids, record.TransactionID)
+		}
+	}
+	failures, err := s.store.Failures()
+	if err != nil {
+		fmt.Println("Failed to find failed transactions:", err)
+	}
+	failed := map[string]bool{}
+	for _, failure := range failures {
+		failed[failure.TransactionID] = true
+		if !seen[failure.TransactionID] {
+			seen[failure.TransactionID] = true
+			outstanding[failure.TransactionID] = failure.Tag
+			ids = append(ids, failure.TransactionID)
+		}
+	}
+
+	for _, id := range ids {
+		tnx, err := s.monzoClient.TransactionByID(s.ctx, accountID, id)
+		if err == monzo.ErrNoTransactionFound {
+			fmt.Printf("Transaction %v no longer exists\n", id)
+			if failed[id] && !s.dryRun {
+				if err := s.store.ClearFailure(id); err != nil {
+					fmt.Printf("Failed to clear failure of transaction %v: %v\n", id, err)
+				}
+			}
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Failed to fetch transaction %v: %v\n", id, err)
+			continue
+		}
+		if err := s.syncOne(*tnx); err != nil {
+			s.tagFailed(*tnx, outstanding[id], err.Error())
+		}
+	}
+}
+
+// syncOne syncs a single transaction, whether it is tagged, has had its tag
+// removed, or is a refund.
+func (s *syncer) syncOne(tnx monzo.Transaction) error {
+	transactions := []monzo.Transaction{tnx}
+	if tagged := getTaggedTransactions(transactions, s.config.Rules); len(tagged) > 0 {
+		return s.syncTransaction(tagged[0])
+	}
+	if err := s.removeUntagged(tnx); err != nil {
+		return err
+	}
+	if refunds := getUntaggedRefunds(transactions); s.config.Sync.LinkRefunds && len(refunds) > 0 {
+		return s.syncLinkedRefund(refunds[0])
+	}
+	return nil
+}
+
+// repushTransaction adds a transaction to Splitwise again, even if its expense
+// was deleted on Splitwise.
+func repushTransaction(config ms.Config, transactionID string) error {
+	store, err := state.Open(config.StatePath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	record, err := store.Get(transactionID)
+	if err != nil && err != state.ErrNotFound {
+		return err
+	}
+	if record != nil {
+		if !record.Deleted && !record.Untagged {
+			return fmt.Errorf("expense %v for transaction %v hasn't been deleted", record.ExpenseID, transactionID)
+		}
+		// Treat it like a transaction that was tagged again
+		record.Deleted = false
+		record.Untagged = true
+		if err := store.Put(*record); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	monzoClient, err := authenticateMonzo(ctx, &config)
+	if err != nil {
+		return err
+	}
+	accounts, err := monzoClient.Accounts(ctx)
+	if err != nil {
+		return err
+	}
+	return syncTransactionByID(ctx, &config, store, selectAccount(accounts).ID, transactionID, true)
+}
+
+// printFailures prints the tagged transactions that couldn't be added to
+// Splitwise. They are cleared once the transaction is added.
+func printFailures(config ms.Config) error {
+	store, err := state.Open(config.StatePath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	failures, err := store.Failures()
+	if err != nil {
+		return err
+	}
+	for _, failure := range failures {
+		fmt.Printf("%v %v %v: %v\n", failure.FailedAt.Format(dateFormat), failure.TransactionID,
+			failure.Tag, failure.Reason)
+	}
+	return nil
+}
+
+// syncTransactionByID fetches a single transaction from Monzo and syncs it.
+func syncTransactionByID(ctx context.Context, config *ms.Config, store *state.Store,
+	accountID, transactionID string, interactive bool) error {
+	monzoClient, err := authenticateMonzo(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	transaction, err := monzoClient.TransactionByID(ctx, accountID, transactionID)
+	if err != nil {
+		return err
+	}
+	tagged := getTaggedTransactions([]monzo.Transaction{*transaction}, config.Rules)
+	var refunds []monzo.Transaction
+	if config.Sync.LinkRefunds {
+		refunds = getUntaggedRefunds([]monzo.Transaction{*transaction})
+	}
+	untagged := getUntagged([]monzo.Transaction{*transaction}, config.Rules)
+	if len(untagged) > 0 {
+		// Only transactions that were synced before need their tag removal handled
+		if _, err := store.Get(transaction.ID); err == state.ErrNotFound {
+			untagged = nil
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(tagged) == 0 && len(refunds) == 0 && len(untagged) == 0 {
+		return nil
+	}
+
+	splitwiseClient := splitwise.NewClient(ctx, config.Splitwise)
+	curUser, err := splitwiseClient.GetCurrentUser()
+	if err != nil {
+		return err
+	}
+	groups, err := splitwiseClient.GetGroups()
+	if err != nil {
+		return err
+	}
+	friends, err := splitwiseClient.GetFriends()
+	if err != nil {
+		return err
+	}
+	// Only expenses around the transaction's date can be duplicates of it
+	created, err := time.Parse(time.RFC3339, transaction.Created)
+	if err != nil {
+		return err
+	}
+	dateSince := created.Add(-24 * time.Hour).Format(time.RFC3339)
+	expenses, err := getExpenses(splitwiseClient, groups, dateSince, "")
+	if err != nil {
+		return err
+	}
+
+	s := &syncer{
+		ctx:             ctx,
+		config:          *config,
+		store:           store,
+		monzoClient:     monzoClient,
+		splitwiseClient: splitwiseClient,
+		curUser:         *curUser,
+		groups:          groups,
+		friends:         friends,
+		expenses:        expenses,
+		// Only commands run from a terminal can ask for confirmation
+		interactive: interactive,
+	}
+	return s.syncOne(*transaction)
+}
+
+// syncSince returns the time a sync should start from: the stored cursor minus
+// the configured overlap, or 15 days ago if nothing has been synced before.
+func syncSince(config ms.Config, store *state.Store) (time.Time, error) {
+	cursor, err := store.Cursor()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if cursor.IsZero() {
+		return time.Now().Add(time.Duration(-15*24) * time.Hour), nil
+	}
+	overlap, err := time.ParseDuration(config.Sync.Overlap)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid sync overlap %q: %v", config.Sync.Overlap, err)
+	}
+	return cursor.Add(-overlap), nil
+}
+
+// latestCreated returns the creation time of the newest transaction.
+func latestCreated(transactions []monzo.Transaction) (time.Time, error) {
+	var latest time.Time
+	for _, v := range transactions {
+		created, err := time.Parse(time.RFC3339, v.Created)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if created.After(latest) {
+			latest = created
+		}
+	}
+	return latest, nil
+}
+
+// getExpenses fetches non-group expenses and the expenses of every group dated
+// after dateSince, and before dateBefore if it is set.
+func getExpenses(splitwiseClient *splitwise.Client, groups []splitwise.Group, dateSince, dateBefore string) ([]splitwise.Expense, error) {
+	expenses, err := splitwiseClient.GetAllExpenses("", dateSince, dateBefore)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Fetched %v expenses\n", len(expenses))
+	for _, grp := range groups {
+		groupExpenses, err := splitwiseClient.GetAllExpenses(fmt.Sprintf("%d", grp.ID), dateSince, dateBefore)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Fetched %v expenses for %v\n", len(groupExpenses), grp.Name)
+		expenses = append(expenses, groupExpenses...)
+	}
+	return expenses, nil
+}
+
+// syncTransaction adds a tagged transaction to Splitwise. If an expense for it
+// already exists, the expense is updated if the transaction settled at a
+// different amount.
+func (s *syncer) syncTransaction(v taggedTransaction) error {
+	tnx := v.Transaction
+
+	// Check if expense already exists
+	record, err := s.getRecord(v)
+	if err != nil {
+		return err
+	}
+	if record != nil && record.Deleted {
+		// Never add an expense again once someone has deleted it
+		return nil
+	}
+	if record != nil && record.Untagged {
+		// The tag was added back after the expense was deleted
+		record = nil
+	}
+	retagged := record != nil && record.Tag != "" && !strings.EqualFold(record.Tag, v.Tag)
+	if record != nil && !retagged && tnx.Settled == "" {
+		// The amount can only change once the transaction settles
+		return nil
+	}
+	if record != nil && !retagged && record.Settled {
+		// Nothing can change once the expense has the settled amount, so
+		// don't report problems with a tag that was already synced
+		if s.dryRun {
+			return nil
+		}
+		return s.store.ClearFailure(tnx.ID)
+	}
+
+	expense, groupName := s.buildExpense(v)
+	if expense == nil {
+		return nil
+	}
+	if !s.dryRun {
+		if err := s.store.ClearFailure(tnx.ID); err != nil {
+			return err
+		}
+	}
+	if retagged {
+		return s.retag(v, *record, *expense, groupName)
+	}
+	if record != nil {
+		return s.updateSettledAmount(tnx, *record, *expense)
+	}
+	if s.dryRun {
+		return printExpense(groupName, tnx, *expense)
+	}
+
+	expense.Receipt, err = s.getReceipt(tnx)
+	if err != nil {
+		// A missing receipt shouldn't stop the expense from being added
+		fmt.Println("Failed to download receipt:", err)
+	}
+	fmt.Println("Adding expense to group", groupName)
+	added, err := s.splitwiseClient.AddExpense(*expense)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Added expense:")
+	fmt.Println(added)
+	return s.putRecord(v, *added, "")
+}
+
+// retag reconciles an expense with its transaction's edited tag. Expenses
+// that are now in a different group are added to it and deleted from the old
+// group, otherwise the expense is updated in place.
+func (s *syncer) retag(v taggedTransaction, record state.Record,
+	expense splitwise.ExpenseRequest, groupName string) error {
+	tnx, tag := v.Transaction, v.Tag
+	deleted, err := s.expenseDeleted(&record)
+	if err != nil || deleted {
+		return err
+	}
+
+	if expense.GroupID == fmt.Sprintf("%v", record.GroupID) {
+		comment := fmt.Sprintf("The Monzo transaction's tag was changed from %v to %v.", record.Tag, tag)
+		if s.dryRun {
+			fmt.Printf("Would update expense %v: %v\n", record.ExpenseID, comment)
+			return nil
+		}
+		fmt.Printf("Updating expense %v: %v\n", record.ExpenseID, comment)
+		updated, err := s.splitwiseClient.UpdateExpense(record.ExpenseID, expense)
+		if err != nil {
+			return err
+		}
+		if _, err := s.splitwiseClient.CreateComment(record.ExpenseID, comment); err != nil {
+			return err
+		}
+		return s.putRecord(v, *updated, record.RefundOf)
+	}
+
+	action := fmt.Sprintf("Move expense %v for transaction %v from %v to %v", record.ExpenseID, tnx.ID, record.Tag, tag)
+	if s.dryRun {
+		fmt.Println("Would", strings.ToLower(action[:1])+action[1:])
+		return printExpense(groupName, tnx, expense)
+	}
+	if !s.confirm(action) {
+		return nil
+	}
+	fmt.Println(action)
+
+	// Add the new expense before deleting the old one, so a failure never
+	// leaves the transaction without an expense
+	expense.Receipt, err = s.getReceipt(tnx)
+	if err != nil {
+		// A missing receipt shouldn't stop the expense from being moved
+		fmt.Println("Failed to download receipt:", err)
+	}
+	fmt.Println("Adding expense to group", groupName)
+	added, err := s.splitwiseClient.AddExpense(expense)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Added expense:")
+	fmt.Println(added)
+	if err := s.putRecord(v, *added, ""); err != nil {
+		return err
+	}
+	if err := s.splitwiseClient.DeleteExpense(record.ExpenseID); err != nil {
+		return fmt.Errorf("moved to expense %v but failed to delete expense %v: %v", added.ID, record.ExpenseID, err)
+	}
+	return nil
+}
+
+// removeUntagged deletes the expense added for a transaction whose tag has
+// since been removed from its notes.
+func (s *syncer) removeUntagged(tnx monzo.Transaction) error {
+	if !s.dryRun {
+		// Failures are no longer relevant once the tag is removed
+		if err := s.store.ClearFailure(tnx.ID); err != nil {
+			return err
+		}
+	}
+	record, err := s.store.Get(tnx.ID)
+	if err == state.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if record.Tag == "" || record.Deleted || record.Untagged {
+		// Linked refunds are never tagged
+		return nil
+	}
+	if record.FromRule {
+		// Rules can be changed or removed without anyone meaning to unshare
+		// the transactions they matched
+		fmt.Printf("Expense %v for transaction %v was added by a rule that no longer matches it; delete it on Splitwise if it is no longer shared\n",
+			record.ExpenseID, tnx.ID)
+		return nil
+	}
+	deleted, err := s.expenseDeleted(record)
+	if err != nil || deleted {
+		return err
+	}
+
+	action := fmt.Sprintf("Delete expense %v as the tag %v was removed from transaction %v", record.ExpenseID, record.Tag, tnx.ID)
+	if s.dryRun {
+		fmt.Println("Would", strings.ToLower(action[:1])+action[1:])
+		return nil
+	}
+	if !s.confirm(action) {
+		return nil
+	}
+	fmt.Println(action)
+	if err := s.splitwiseClient.DeleteExpense(record.ExpenseID); err != nil {
+		return err
+	}
+	record.Untagged = true
+	return s.store.Put(*record)
+}
+
+// expenseDeleted reports whether the expense for record was deleted on
+// Splitwise, marking the record as deleted if so.
+func (s *syncer) expenseDeleted(record *state.Record) (bool, error) {
+	if record.Deleted {
+		return true, nil
+	}
+	expense, err := s.splitwiseClient.GetExpense(record.ExpenseID)
+	if err != nil {
+		return false, err
+	}
+	if expense.DeletedAt == nil {
+		return false, nil
+	}
+	return true, s.markDeleted(record)
+}
+
+// markDeleted records that the expense for record was deleted on Splitwise.
+func (s *syncer) markDeleted(record *state.Record) error {
+	fmt.Printf("Expense %v for transaction %v was deleted on Splitwise, it won't be added again\n",
+		record.ExpenseID, record.TransactionID)
+	record.Deleted = true
+	if s.dryRun {
+		return nil
+	}
+	return s.store.Put(*record)
+}
+
+// confirm asks whether to go ahead with deleting or moving an expense, if
+// configured to. Without a terminal, nothing is confirmed.
+func (s *syncer) confirm(action string) bool {
+	if !s.config.Sync.ConfirmChanges {
+		return true
+	}
+	if !s.interactive {
+		fmt.Printf("Skipping as confirmation is required: %v\n", action)
+		return false
+	}
+	fmt.Printf("%v? [y/N] ", action)
+	var answer string
+	fmt.Scanln(&answer)
+	return strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+}
+
+// updateSettledAmount updates the expense for a settled transaction if its
+// amount differs from the amount the expense was added with, and comments on
+// the expense to explain why.
+func (s *syncer) updateSettledAmount(tnx monzo.Transaction, record state.Record, expense splitwise.ExpenseRequest) error {
+	amount := expense.Cost
+	if amount < 0 {
+		amount = -amount
+	}
+	if amount == record.Amount && expense.CurrencyCode == record.Currency {
+		if record.Settled || s.dryRun {
+			return nil
+		}
+		// Stop checking the transaction for changes
+		record.Settled = true
+		return s.store.Put(record)
+	}
+	deleted, err := s.expenseDeleted(&record)
+	if err != nil || deleted {
+		return err
+	}
+
+	comment := fmt.Sprintf("The Monzo transaction settled at %v, so this expense was updated from %v.",
+		formatAmount(amount, expense.CurrencyCode), formatAmount(record.Amount, record.Currency))
+	if s.dryRun {
+		fmt.Printf("Would update expense %v: %v\n", record.ExpenseID, comment)
+		return nil
+	}
+
+	fmt.Printf("Updating expense %v: %v\n", record.ExpenseID, comment)
+	updated, err := s.splitwiseClient.UpdateExpense(record.ExpenseID, expense)
+	if err != nil {
+		return err
+	}
+	if _, err := s.splitwiseClient.CreateComment(record.ExpenseID, comment); err != nil {
+		return err
+	}
+	return s.putRecord(taggedTransaction{tnx, record.Tag, record.FromRule}, *updated, record.RefundOf)
+}
+
+// buildExpense returns the expense to add for a tagged transaction and the
+// name of its group. If the tag can't be used, the problem is reported and nil
+// is returned.
+func (s *syncer) buildExpense(v taggedTransaction) (*splitwise.ExpenseRequest, string) {
+	tag := v.Tag
+	tnx := v.Transaction
+
+	var groupID string
+	var groupName string
+	var participants []participant
+
+	// Get group ID
+	spec := parseTag(tag)
+	switch spec.Group {
+	case "":
+		groupID = "0"
+		groupName = "Non-group expenses"
+		participants = append(participants, participant{s.curUser.ID, s.curUser.FirstName, s.curUser.LastName})
+		// Non-group expenses are split with the friends named in the tag
+		if len(spec.People) > 0 {
+			for _, friend := range s.friends {
+				participants = append(participants, participant{friend.ID, friend.FirstName, friend.LastName})
+			}
+		}
+	default:
+		groupName = spec.Group
+		group, err := findGroup(s.groups, s.config.Groups, groupName)
+		if err != nil {
+			s.tagFailed(tnx, tag, err.Error())
+			return nil, ""
+		}
+		groupID = fmt.Sprintf("%v", group.ID)
+		for _, member := range group.Members {
+			participants = append(participants, participant{member.ID, member.FirstName, member.LastName})
+		}
+	}
+
+	participants, err := selectParticipants(spec, participants, s.curUser.ID, s.config.UserAliases)
+	if err != nil {
+		s.tagFailed(tnx, tag, fmt.Sprintf("Invalid participants: %v", err))
+		return nil, ""
+	}
+	split, err := getSplit(spec, tnx.Notes, participants, s.curUser.ID, s.config.UserAliases)
+	if err != nil {
+		s.tagFailed(tnx, tag, fmt.Sprintf("Invalid split: %v", err))
+		return nil, ""
+	}
+	var groupUsers []string
+	for _, p := range participants {
+		groupUsers = append(groupUsers, fmt.Sprintf("%v", p.ID))
+	}
+
+	groupConfig, _ := findGroupConfig(s.config.Groups, spec.Group)
+	amount, currency, err := expenseAmount(tnx, groupConfig.Currency)
+	if err != nil {
+		s.tagFailed(tnx, tag, fmt.Sprintf("Invalid currency: %v", err))
+		return nil, ""
+	}
+	details := fmt.Sprintf("MonzoTransaction:%v", tnx.ID)
+	if tnx.LocalCurrency != "" && tnx.LocalCurrency != tnx.Currency {
+		details += fmt.Sprintf("\nAdded in %v. Spent %v, charged %v.", currency,
+			formatAmount(tnx.LocalAmount, tnx.LocalCurrency), formatAmount(tnx.Amount, tnx.Currency))
+	}
+
+	expense := splitwise.ExpenseRequest{
+		Payment:        "false",
+		Cost:           amount,
+		CurrencyCode:   currency,
+		Description:    description(tnx),
+		GroupID:        groupID,
+		Details:        details,
+		Date:           tnx.Created,
+		CreationMethod: "split",
+		CategoryID:     expenseCategory(tnx, groupConfig),
+		Self:           fmt.Sprintf("%v", s.curUser.ID),
+		Users:          groupUsers,
+		Split:          split,
+		// Credits are refunds, paid back to everyone who shared the cost
+		Reverse: tnx.Amount > 0,
+	}
+	return &expense, groupName
+}
+
+// tagFailed reports why a transaction can't be synced to Splitwise, keeping a
+// record of it that the failures command lists.
+func (s *syncer) tagFailed(tnx monzo.Transaction, tag, reason string) {
+	fmt.Printf("Failed to sync transaction %v: %v\n", tnx.ID, reason)
+	if s.dryRun {
+		return
+	}
+	failure := state.Failure{
+		TransactionID: tnx.ID,
+		Tag:           tag,
+		Reason:        reason,
+		FailedAt:      time.Now(),
+	}
+	if err := s.store.PutFailure(failure); err != nil {
+		fmt.Println("Failed to record failure:", err)
+	}
+}
+
+// syncLinkedRefund reverses the expense of the most recent synced transaction
+// from the same merchant as an untagged refund. The refund is split in
+// proportion to what each user owed for the original expense.
+func (s *syncer) syncLinkedRefund(tnx monzo.Transaction) error {
+	record, err := s.getRecord(taggedTransaction{Transaction: tnx})
+	if err != nil {
+		return err
+	}
+	if record != nil {
+		return nil
+	}
+
+	original, err := s.findRefunded(tnx)
+	if err != nil {
+		return err
+	}
+	if original == nil {
+		return nil
+	}
+	expense, err := s.splitwiseClient.GetExpense(original.ExpenseID)
+	if err != nil {
+		return err
+	}
+
+	// Refund in the same currency as the original expense
+	amount := tnx.Amount
+	if expense.CurrencyCode == tnx.LocalCurrency {
+		amount = tnx.LocalAmount
+	} else if expense.CurrencyCode != tnx.Currency {
+		fmt.Printf("Refund %v is not in the currency of expense %v\n", tnx.ID, expense.ID)
+		return nil
+	}
+
+	var users []string
+	split := splitwise.Split{Kind: splitwise.SplitShares}
+	for _, user := range expense.Users {
+		owed, err := splitwise.ParseAmount(user.OwedShare, expense.CurrencyCode)
+		if err != nil {
+			return err
+		}
+		users = append(users, fmt.Sprintf("%v", user.UserID))
+		split.Entries = append(split.Entries, splitwise.SplitEntry{Value: owed})
+	}
+
+	refund := splitwise.ExpenseRequest{
+		Payment:        "false",
+		Cost:           amount,
+		CurrencyCode:   expense.CurrencyCode,
+		Description:    fmt.Sprintf("Refund: %v", expense.Description),
+		GroupID:        fmt.Sprintf("%v", expense.GroupID),
+		Details:        fmt.Sprintf("MonzoTransaction:%v", tnx.ID),
+		Date:           tnx.Created,
+		CreationMethod: "split",
+		CategoryID:     expense.Category.ID,
+		Self:           fmt.Sprintf("%v", s.curUser.ID),
+		Users:          users,
+		Split:          split,
+		Reverse:        true,
+	}
+	if s.dryRun {
+		return printExpense(fmt.Sprintf("%v", expense.GroupID), tnx, refund)
+	}
+
+	fmt.Printf("Adding refund of expense %v\n", expense.ID)
+	added, err := s.splitwiseClient.AddExpense(refund)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Added expense:")
+	fmt.Println(added)
+	return s.putRecord(taggedTransaction{Transaction: tnx}, *added, original.TransactionID)
+}
+
+// findRefunded returns the record of the most recent synced debit from the
+// same merchant as a refund, which was at least as large as the refund.
+func (s *syncer) findRefunded(refund monzo.Transaction) (*state.Record, error) {
+	records, err := s.store.FindByMerchant(refund.Merchant.ID)
+	if err != nil {
+		return nil, err
+	}
+	var found *state.Record
+	for i, record := range records {
+		if record.RefundOf != "" || record.Deleted || record.Untagged {
+			continue
+		}
+		if record.Currency == refund.Currency && refund.Amount > record.Amount {
+			continue
+		}
+		if found == nil || record.SyncedAt.After(found.SyncedAt) {
+			found = &records[i]
+		}
+	}
+	return found, nil
+}
+
+// description returns the description of the expense for tnx.
+func description(tnx monzo.Transaction) string {
+	name := tnx.Merchant.Name
+	if name == "" {
+		name = tnx.Description
+	}
+	if tnx.Amount > 0 {
+		return fmt.Sprintf("Refund: %v", name)
+	}
+	return name
+}
+
+// expenseAmount returns the amount and currency to create the expense for tnx
+// in, following a group's currency setting.
+func expenseAmount(tnx monzo.Transaction, currency string) (int, string, error) {
+	local := tnx.LocalCurrency != ""
+	switch strings.ToLower(currency) {
+	case "", "settlement":
+		return tnx.Amount, tnx.Currency, nil
+	case "local":
+		if !local {
+			return tnx.Amount, tnx.Currency, nil
+		}
+		return tnx.LocalAmount, tnx.LocalCurrency, nil
+	default:
+		code := strings.ToUpper(currency)
+		if local && tnx.LocalCurrency == code {
+			return tnx.LocalAmount, tnx.LocalCurrency, nil
+		}
+		if tnx.Currency == code {
+			return tnx.Amount, tnx.Currency, nil
+		}
+		return 0, "", fmt.Errorf("transaction was not made or charged in the group's currency %v", code)
+	}
+}
+
+// formatAmount formats an amount in minor units for printing, e.g. "12.34 GBP".
+func formatAmount(amount int, currency string) string {
+	formatted, err := splitwise.FormatAmount(int64(amount), currency)
+	if err != nil {
+		return fmt.Sprintf("%v minor units of %v", amount, currency)
+	}
+	return fmt.Sprintf("%v %v", formatted, currency)
+}
+
+// printExpense prints the create_expense payload that would be sent for tnx.
+func printExpense(groupName string, tnx monzo.Transaction, expense splitwise.ExpenseRequest) error {
+	form, err := expense.Form()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Printf("Would add expense for transaction %v to group %v:\n", tnx.ID, groupName)
+	for _, k := range keys {
+		fmt.Printf("  %v: %v\n", k, form.Get(k))
+	}
+	if len(tnx.Attachments) > 0 {
+		fmt.Printf("  receipt: %v attachment(s) on transaction\n", len(tnx.Attachments))
+	}
+	return nil
+}
+
+// getRecord returns the record of the expense added for a transaction, or nil
+// if there isn't one. The state store is the source of truth, but expenses
+// created before it existed are found by their details and recorded with the
+// transaction's tag.
+func (s *syncer) getRecord(v taggedTransaction) (*state.Record, error) {
+	tnx := v.Transaction
+	record, err := s.store.Get(tnx.ID)
+	if err == nil {
+		// Notice deletions of any expenses that were fetched
+		for _, exp := range s.expenses {
+			if exp.ID == record.ExpenseID && exp.DeletedAt != nil && !record.Deleted && !record.Untagged {
+				return record, s.markDeleted(record)
+			}
+		}
+		return record, nil
+	}
+	if err != state.ErrNotFound {
+		return nil, err
+	}
+
+	for _, exp := range s.expenses {
+		if strings.Contains(exp.Details, tnx.ID) {
+			record, err := newRecord(v, exp, "")
+			if err != nil {
+				return nil, err
+			}
+			record.Deleted = exp.DeletedAt != nil
+			if !s.dryRun {
+				err = s.store.Put(record)
+			}
+			return &record, err
+		}
+	}
+	return nil, nil
+}
+
+// putRecord records that expense was created for a tagged transaction,
+// refunding the transaction refundOf if it is set.
+func (s *syncer) putRecord(v taggedTransaction, expense splitwise.Expense, refundOf string) error {
+	record, err := newRecord(v, expense, refundOf)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(record)
+}
+
+// newRecord returns the state record for an expense created for a tagged
+// transaction.
+func newRecord(v taggedTransaction, expense splitwise.Expense, refundOf string) (state.Record, error) {
+	tnx := v.Transaction
+	amount, err := splitwise.ParseAmount(expense.Cost, expense.CurrencyCode)
+	if err != nil {
+		return state.Record{}, err
+	}
+	if amount < 0 {
+		amount = -amount
+	}
+	created, err := time.Parse(time.RFC3339, tnx.Created)
+	if err != nil {
+		return state.Record{}, err
+	}
+	return state.Record{
+		TransactionID: tnx.ID,
+		ExpenseID:     expense.ID,
+		GroupID:       expense.GroupID,
+		Amount:        int(amount),
+		Currency:      expense.CurrencyCode,
+		MerchantID:    tnx.Merchant.ID,
+		Tag:           v.Tag,
+		FromRule:      v.FromRule,
+		RefundOf:      refundOf,
+		Settled:       tnx.Settled != "",
+		Created:       created,
+		SyncedAt:      time.Now(),
+	}, nil
+}
+
+// getReceipt downloads the first photo attached to a transaction, if any.
+func (s *syncer) getReceipt(tnx monzo.Transaction) (*splitwise.Receipt, error) {
+	for _, attachment := range tnx.Attachments {
+		if !strings.HasPrefix(attachment.FileType, "image/") {
+			continue
+		}
+		fileURL, err := url.Parse(attachment.FileUrl)
+		if err != nil {
+			return nil, err
+		}
+		data, err := s.monzoClient.DownloadAttachment(s.ctx, attachment)
+		if err != nil {
+			return nil, err
+		}
+		return &splitwise.Receipt{
+			Filename:    path.Base(fileURL.Path),
+			ContentType: attachment.FileType,
+			Data:        data,
+		}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cheahjs/monzosplitwise/splitwise"
+)
+
+// tagPrefix starts every tag that marks a transaction to be split
+const tagPrefix = "#splitwise"
+
+// tagSpec is a parsed #splitwise[-<group>][@<person>...][=<split>] tag
+type tagSpec struct {
+	// Group is the group name after "-", empty for non-group expenses
+	Group string
+	// People are the names given after "@", empty to split with everyone
+	People []string
+	// Split is the split given after "=", empty for an equal split
+	Split string
+}
+
+// participant is a Splitwise user that an expense can be split with
+type participant struct {
+	ID        int
+	FirstName string
+	LastName  string
+}
+
+// namedShare is a name=value entry in a transaction's notes, giving a single
+// participant's part of the split
+type namedShare struct {
+	Name  string
+	Value string
+}
+
+// noParticipantError is returned when no participant has a name
+type noParticipantError struct {
+	Name string
+}
+
+func (e noParticipantError) Error() string {
+	return fmt.Sprintf("no participant called %v", e.Name)
+}
+
+// parseTag parses a note field containing a #splitwise tag. Anything before
+// the tag in the field is ignored.
+func parseTag(tag string) tagSpec {
+	spec := tagSpec{}
+	start := strings.Index(tag, tagPrefix)
+	if start < 0 {
+		return spec
+	}
+	body := tag[start+len(tagPrefix):]
+	if i := strings.Index(body, "="); i >= 0 {
+		body, spec.Split = body[:i], body[i+1:]
+	}
+	names := strings.Split(body, "@")
+	spec.Group = strings.TrimPrefix(names[0], "-")
+	for _, name := range names[1:] {
+		if name != "" {
+			spec.People = append(spec.People, name)
+		}
+	}
+	return spec
+}
+
+// selectParticipants returns the participants named in the tag, always
+// starting with the current user who paid. If no one is named, everyone
+// participates.
+func selectParticipants(spec tagSpec, participants []participant, self int, aliases map[string]int) ([]participant, error) {
+	if len(spec.People) == 0 {
+		return participants, nil
+	}
+	i, err := findParticipant(participants, "me", self, aliases)
+	if err != nil {
+		return nil, err
+	}
+	selected := []participant{participants[i]}
+	for _, name := range spec.People {
+		i, err := findParticipant(participants, name, self, aliases)
+		if err != nil {
+			return nil, err
+		}
+		duplicate := false
+		for _, p := range selected {
+			duplicate = duplicate || p.ID == participants[i].ID
+		}
+		if !duplicate {
+			selected = append(selected, participants[i])
+		}
+	}
+	return selected, nil
+}
+
+// getSplit returns how an expense is split between participants, either from
+// the split in the tag, which lists a part for every participant in order, or
+// from name=value entries elsewhere in the notes. Participants not named share
+// whatever is left. Entries whose name isn't a participant, such as in URLs,
+// are ignored.
+func getSplit(spec tagSpec, notes string, participants []participant, self int, aliases map[string]int) (splitwise.Split, error) {
+	entries := make([]string, len(participants))
+	for i := range entries {
+		entries[i] = "*"
+	}
+	named := false
+	for _, share := range getNamedShares(notes) {
+		i, err := findParticipant(participants, share.Name, self, aliases)
+		if _, ok := err.(noParticipantError); ok {
+			continue
+		}
+		if err != nil {
+			return splitwise.Split{}, err
+		}
+		if entries[i] != "*" {
+			return splitwise.Split{}, fmt.Errorf("%v is named more than once", share.Name)
+		}
+		entries[i] = share.Value
+		named = true
+	}
+
+	if spec.Split != "" && named {
+		return splitwise.Split{}, fmt.Errorf("split given in both the tag and the notes")
+	}
+	if spec.Split != "" {
+		return splitwise.ParseSplit(spec.Split)
+	}
+	if !named {
+		return splitwise.Split{}, nil
+	}
+	return splitwise.ParseSplit(strings.Join(entries, ":"))
+}
+
+// getNamedShares returns the name=value entries in notes.
+func getNamedShares(notes string) []namedShare {
+	var named []namedShare
+	for _, field := range strings.Fields(notes) {
+		if strings.HasPrefix(field, "#") {
+			continue
+		}
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		named = append(named, namedShare{parts[0], parts[1]})
+	}
+	return named
+}
+
+// findParticipant returns the index of the participant called name. "me" is
+// the current user, and configured aliases are matched by user ID. Anyone else
+// is matched by first name, or by full name without spaces if first names are
+// shared.
+func findParticipant(participants []participant, name string, self int, aliases map[string]int) (int, error) {
+	id, isAlias := aliases[strings.ToLower(name)]
+	if strings.EqualFold(name, "me") {
+		id, isAlias = self, true
+	}
+	if isAlias {
+		for i, p := range participants {
+			if p.ID == id {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("%v is not a participant", name)
+	}
+
+	found := -1
+	for i, p := range participants {
+		fullName := strings.Replace(p.FirstName+p.LastName, " ", "", -1)
+		if !strings.EqualFold(p.FirstName, name) && !strings.EqualFold(fullName, name) {
+			continue
+		}
+		if found >= 0 {
+			return 0, fmt.Errorf("more than one participant is called %v", name)
+		}
+		found = i
+	}
+	if found < 0 {
+		return 0, noParticipantError{name}
+	}
+	return found, nil
+}
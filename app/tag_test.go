@@ -0,0 +1,165 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cheahjs/monzosplitwise/splitwise"
+)
+
+var (
+	me        = participant{1, "Jo", "Smith"}
+	alice     = participant{2, "Alice", "Brown"}
+	samLee    = participant{3, "Sam", "Lee"}
+	samTaylor = participant{4, "Sam", "Taylor"}
+	aliases   = map[string]int{"al": 2, "stranger": 9}
+)
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want tagSpec
+	}{
+		{"#splitwise", tagSpec{}},
+		{"#splitwise-flat", tagSpec{Group: "flat"}},
+		{"#splitwise-flat=2:1:1", tagSpec{Group: "flat", Split: "2:1:1"}},
+		{"#splitwise-flat@alice@bob", tagSpec{Group: "flat", People: []string{"alice", "bob"}}},
+		{"#splitwise@alice=*:12.50", tagSpec{People: []string{"alice"}, Split: "*:12.50"}},
+		{"#splitwise-flat@@alice@", tagSpec{Group: "flat", People: []string{"alice"}}},
+		{"(#splitwise-flat", tagSpec{Group: "flat"}},
+		// Lowercasing these prefixes changes their length in bytes
+		{"ȺȺȺ#splitwise-flat", tagSpec{Group: "flat"}},
+		{"İ#splitwise", tagSpec{}},
+		{"İİ#splitwise-café=60%:*", tagSpec{Group: "café", Split: "60%:*"}},
+		{"#Splitwise-flat", tagSpec{}},
+	}
+	for _, test := range tests {
+		if got := parseTag(test.tag); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseTag(%q) = %+v, want %+v", test.tag, got, test.want)
+		}
+	}
+}
+
+func TestFindParticipant(t *testing.T) {
+	participants := []participant{me, alice, samLee, samTaylor}
+	tests := []struct {
+		name string
+		want int
+		// wantErr is "" for no error, "none" if no participant has the name,
+		// or "other" for any other error
+		wantErr string
+	}{
+		{"me", 0, ""},
+		{"ME", 0, ""},
+		{"alice", 1, ""},
+		{"Alice", 1, ""},
+		{"AliceBrown", 1, ""},
+		{"al", 1, ""},
+		{"Al", 1, ""},
+		// Shared first names need the full name
+		{"sam", 0, "other"},
+		{"samlee", 2, ""},
+		{"SamTaylor", 3, ""},
+		{"bob", 0, "none"},
+		{"https://example.com/?a", 0, "none"},
+		// Aliases of users who aren't participants are an error
+		{"stranger", 0, "other"},
+	}
+	for _, test := range tests {
+		got, err := findParticipant(participants, test.name, me.ID, aliases)
+		errKind := ""
+		if _, ok := err.(noParticipantError); ok {
+			errKind = "none"
+		} else if err != nil {
+			errKind = "other"
+		}
+		if errKind != test.wantErr {
+			t.Errorf("findParticipant(%q) error = %v, want %q", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && got != test.want {
+			t.Errorf("findParticipant(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSelectParticipants(t *testing.T) {
+	participants := []participant{alice, me, samLee, samTaylor}
+	tests := []struct {
+		people  []string
+		want    []participant
+		wantErr bool
+	}{
+		{nil, participants, false},
+		// The current user is always included first
+		{[]string{"alice"}, []participant{me, alice}, false},
+		{[]string{"samlee", "alice"}, []participant{me, samLee, alice}, false},
+		{[]string{"alice", "al", "me"}, []participant{me, alice}, false},
+		{[]string{"sam"}, nil, true},
+		{[]string{"bob"}, nil, true},
+	}
+	for _, test := range tests {
+		got, err := selectParticipants(tagSpec{People: test.people}, participants, me.ID, aliases)
+		if (err != nil) != test.wantErr {
+			t.Errorf("selectParticipants(%v) error = %v, want error %v", test.people, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("selectParticipants(%v) = %v, want %v", test.people, got, test.want)
+		}
+	}
+
+	// Without the current user, no one can pay
+	if _, err := selectParticipants(tagSpec{People: []string{"alice"}}, []participant{alice}, me.ID, aliases); err == nil {
+		t.Errorf("selectParticipants without the current user succeeded, want error")
+	}
+}
+
+func TestGetSplit(t *testing.T) {
+	participants := []participant{me, alice, samLee}
+	tests := []struct {
+		split string
+		notes string
+		// want is the split it should be the same as, "" for an equal split
+		want    string
+		wantErr bool
+	}{
+		{"", "#splitwise-flat dinner", "", false},
+		{"2:1:1", "#splitwise-flat=2:1:1", "2:1:1", false},
+		{"", "#splitwise-flat alice=12.50", "*:12.50:*", false},
+		{"", "#splitwise-flat me=50% Alice=30%", "50%:30%:*", false},
+		{"", "#splitwise-flat al=2 samlee=1", "*:2:1", false},
+		// Entries that don't name a participant are ignored
+		{"", "#splitwise-flat https://example.com/?a=b 1+1=2", "", false},
+		{"", "#splitwise-flat https://example.com/?a=b bob=5.00 alice=5.00", "*:5.00:*", false},
+		{"", "#splitwise-flat =5 alice=", "", false},
+		{"2:1:1", "#splitwise-flat=2:1:1 alice=12.50", "", true},
+		{"", "#splitwise-flat alice=1 al=2", "", true},
+		{"", "#splitwise-flat alice=50% samlee=2", "", true},
+	}
+	for _, test := range tests {
+		got, err := getSplit(tagSpec{Group: "flat", Split: test.split}, test.notes, participants, me.ID, aliases)
+		if (err != nil) != test.wantErr {
+			t.Errorf("getSplit(%q, %q) error = %v, want error %v", test.split, test.notes, err, test.wantErr)
+			continue
+		}
+		if test.wantErr {
+			continue
+		}
+		want := splitwise.Split{}
+		if test.want != "" {
+			if want, err = splitwise.ParseSplit(test.want); err != nil {
+				t.Fatalf("ParseSplit(%q) failed: %v", test.want, err)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("getSplit(%q, %q) = %+v, want %+v", test.split, test.notes, got, want)
+		}
+	}
+
+	// Shared first names are ambiguous rather than ignored
+	_, err := getSplit(tagSpec{}, "sam=5.00", []participant{me, samLee, samTaylor}, me.ID, aliases)
+	if _, ok := err.(noParticipantError); err == nil || ok {
+		t.Errorf("getSplit with an ambiguous name error = %v, want ambiguity error", err)
+	}
+}
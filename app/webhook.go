@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	ms "github.com/cheahjs/monzosplitwise"
+	"github.com/cheahjs/monzosplitwise/monzo"
+	"github.com/cheahjs/monzosplitwise/state"
+)
+
+// serveWebhooks listens on addr for Monzo webhooks posted to path, and syncs
+// tagged transactions to Splitwise as soon as they are created or updated.
+// The config and state store are read for each webhook, so that syncs and
+// other commands can run alongside the server and refresh tokens it then uses.
+func serveWebhooks(addr, path string) error {
+	// Monzo sends transaction.created and transaction.updated in quick
+	// succession, handle one at a time to avoid creating duplicate expenses.
+	var mu sync.Mutex
+
+	http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		webhook := monzo.WebhookRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+			http.Error(w, "invalid webhook body", http.StatusBadRequest)
+			return
+		}
+		switch webhook.Type {
+		case "transaction.created", "transaction.updated":
+		default:
+			// Acknowledge events we don't care about so Monzo doesn't retry
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if webhook.Data == nil || webhook.Data.ID == "" {
+			http.Error(w, "missing transaction", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Printf("Received %v for transaction %v\n", webhook.Type, webhook.Data.ID)
+		if err := handleWebhookTransaction(*webhook.Data); err != nil {
+			fmt.Println("Failed to handle webhook:", err)
+			explainError(err)
+			// Non-2xx responses are retried by Monzo
+			http.Error(w, "failed to sync transaction", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	fmt.Printf("Listening for Monzo webhooks on %v%v\n", addr, path)
+	return http.ListenAndServe(addr, nil)
+}
+
+// handleWebhookTransaction syncs the transaction a webhook was sent for.
+func handleWebhookTransaction(data monzo.Transaction) error {
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	// Waits for a sync that is running to finish with the store, or fails so
+	// that Monzo retries the webhook later
+	store, err := state.Open(config.StatePath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	// Syncs refresh and save the Monzo tokens while holding the store, so read
+	// the config again now that none is running
+	config, err = readConfig()
+	if err != nil {
+		return err
+	}
+
+	// Webhooks are unauthenticated, so the transaction is fetched from Monzo
+	// rather than trusting the payload.
+	return syncTransactionByID(context.Background(), &config, store, data.AccountID, data.ID, false)
+}
+
+// ensureWebhook makes sure exactly one webhook for the selected account points
+// at webhookURL, registering one if needed and deleting any duplicates.
+func ensureWebhook(config *ms.Config, webhookURL string) error {
+	ctx := context.Background()
+	monzoClient, err := authenticateMonzo(ctx, config)
+	if err != nil {
+		return err
+	}
+	accounts, err := monzoClient.Accounts(ctx)
+	if err != nil {
+		return err
+	}
+	account := selectAccount(accounts)
+
+	webhooks, err := monzoClient.Webhooks(ctx, account.ID)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, webhook := range webhooks {
+		if webhook.Url != webhookURL {
+			fmt.Printf("Leaving webhook %v for %v\n", webhook.Id, webhook.Url)
+			continue
+		}
+		if !found {
+			fmt.Printf("Webhook %v already points at %v\n", webhook.Id, webhook.Url)
+			found = true
+			continue
+		}
+		fmt.Printf("Deleting duplicate webhook %v\n", webhook.Id)
+		if err := monzoClient.DeleteWebhook(ctx, webhook.Id); err != nil {
+			return err
+		}
+	}
+	if found {
+		return nil
+	}
+
+	webhook, err := monzoClient.RegisterWebhook(ctx, account.ID, webhookURL)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Registered webhook %v for %v\n", webhook.Id, webhook.Url)
+	return nil
+}
@@ -5,14 +5,87 @@ import (
 	"github.com/cheahjs/monzosplitwise/splitwise"
 )
 
+const (
+	// DefaultStatePath is where the sync state database is stored if not configured
+	DefaultStatePath = "state.db"
+	// DefaultSyncOverlap is how far before the sync cursor each run starts if not configured
+	DefaultSyncOverlap = "72h"
+)
+
 // Config holds all config data for app
 type Config struct {
 	Monzo     monzo.MonzoConfig
 	Splitwise splitwise.SplitwiseConfig
+	// StatePath is the file that records which transactions have been synced
+	StatePath string
+	Sync      SyncConfig
+	// UserAliases maps lowercase names used in notes to Splitwise user IDs
+	UserAliases map[string]int
+	// Groups holds settings for each group, keyed by the group name or alias
+	// used in tags, ignoring case, accents, punctuation and emoji
+	Groups map[string]GroupConfig
+	// Rules tag transactions that have no #splitwise tag in their notes
+	Rules []Rule
+}
+
+// Rule tags untagged transactions that match all of its conditions. Empty
+// conditions are ignored, but every rule needs at least one condition.
+type Rule struct {
+	// Merchant matches the merchant's name, ignoring case, or its ID
+	Merchant string
+	// Category matches the Monzo category of the transaction, such as "groceries"
+	Category string
+	// MinAmount and MaxAmount bound the amount spent, in minor units of the
+	// account's currency, such as 1050 for £10.50. Zero means no bound.
+	MinAmount int
+	MaxAmount int
+	// Description matches if the transaction description contains it, ignoring case
+	Description string
+	// Counterparty matches the name, account number or user ID of who a
+	// transfer or direct debit was paid to
+	Counterparty string
+	// Tag is applied to matching transactions, using the same syntax as
+	// notes, such as "#splitwise-flat=2:1"
+	Tag string
+}
+
+// GroupConfig holds settings for expenses added to a Splitwise group
+type GroupConfig struct {
+	// ID is the Splitwise group that the tag adds expenses to. If it is not
+	// set, the tag is matched against group names.
+	ID int
+	// Currency is the currency expenses are created in: "settlement" for the
+	// currency the Monzo account was charged in (the default), "local" for the
+	// currency the transaction was made in, or a currency code that the
+	// group tracks expenses in.
+	Currency string
+	// Categories maps Monzo categories to the Splitwise category IDs
+	// expenses are given, overriding the default mapping
+	Categories map[string]int
+}
+
+// SyncConfig holds config for which transactions each sync run looks at
+type SyncConfig struct {
+	// Overlap is how far before the last processed transaction each run
+	// starts, as a duration such as "72h". This catches transactions whose
+	// notes were edited after a later transaction was processed.
+	Overlap string
+	// LinkRefunds adds untagged refunds from a merchant to Splitwise if an
+	// earlier transaction from the same merchant was synced
+	LinkRefunds bool
+	// ConfirmChanges asks before deleting or moving an expense whose
+	// transaction's tag was removed or changed. Changes are skipped when
+	// running without a terminal to confirm them.
+	ConfirmChanges bool
 }
 
 // GetDefaultConfig returns a default config object with blank fields
 func GetDefaultConfig() Config {
-	config := Config{}
+	config := Config{
+		StatePath: DefaultStatePath,
+		Sync: SyncConfig{
+			Overlap: DefaultSyncOverlap,
+		},
+	}
 	return config
 }
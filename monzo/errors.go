@@ -0,0 +1,56 @@
+package monzo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// APIError is an unsuccessful response from the Monzo API
+type APIError struct {
+	StatusCode int
+	// Code is Monzo's error code, such as "forbidden.insufficient_permissions"
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" && e.Message == "" {
+		return fmt.Sprintf("monzo: %v %v", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("monzo: %v %v: %v", e.StatusCode, e.Code, e.Message)
+}
+
+// IsForbidden reports whether access was refused, which usually means the
+// user has to approve access in the Monzo app
+func (e *APIError) IsForbidden() bool {
+	return e.StatusCode == http.StatusForbidden
+}
+
+// IsRateLimited reports whether too many requests have been made
+func (e *APIError) IsRateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+// IsServerError reports whether Monzo failed to handle the request, which can
+// be retried later
+func (e *APIError) IsServerError() bool {
+	return e.StatusCode >= 500
+}
+
+// checkResponse returns an APIError for an unsuccessful response, closing its body.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err == nil {
+		// The body isn't always JSON, in which case only the status is known
+		json.Unmarshal(b, apiErr)
+	}
+	return apiErr
+}
@@ -0,0 +1,100 @@
+package monzo
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestAPIErrors(t *testing.T) {
+	tests := []struct {
+		statusCode    int
+		body          string
+		wantCode      string
+		forbidden     bool
+		rateLimited   bool
+		serverError   bool
+		wantErrString string
+	}{
+		{http.StatusForbidden, `{"code":"forbidden.insufficient_permissions","message":"Access forbidden"}`,
+			"forbidden.insufficient_permissions", true, false, false,
+			"monzo: 403 forbidden.insufficient_permissions: Access forbidden"},
+		{http.StatusTooManyRequests, `{"code":"too_many_requests","message":"Slow down"}`,
+			"too_many_requests", false, true, false, "monzo: 429 too_many_requests: Slow down"},
+		{http.StatusInternalServerError, `{"code":"internal_service","message":"Something went wrong"}`,
+			"internal_service", false, false, true, "monzo: 500 internal_service: Something went wrong"},
+		// Bodies that aren't JSON only have a status
+		{http.StatusBadGateway, `<html>Bad Gateway</html>`, "", false, false, true, "monzo: 502 Bad Gateway"},
+	}
+	for _, test := range tests {
+		client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.statusCode)
+			w.Write([]byte(test.body))
+		}))
+
+		_, err := client.Transactions(context.Background(), "acc_1", "", "", 100)
+		apiErr, ok := err.(*APIError)
+		if !ok {
+			t.Errorf("status %v: error = %#v, want *APIError", test.statusCode, err)
+			continue
+		}
+		if apiErr.StatusCode != test.statusCode || apiErr.Code != test.wantCode {
+			t.Errorf("status %v: error = %+v, want status %v and code %q", test.statusCode, apiErr, test.statusCode, test.wantCode)
+		}
+		if apiErr.IsForbidden() != test.forbidden {
+			t.Errorf("status %v: IsForbidden() = %v, want %v", test.statusCode, apiErr.IsForbidden(), test.forbidden)
+		}
+		if apiErr.IsRateLimited() != test.rateLimited {
+			t.Errorf("status %v: IsRateLimited() = %v, want %v", test.statusCode, apiErr.IsRateLimited(), test.rateLimited)
+		}
+		if apiErr.IsServerError() != test.serverError {
+			t.Errorf("status %v: IsServerError() = %v, want %v", test.statusCode, apiErr.IsServerError(), test.serverError)
+		}
+		if got := apiErr.Error(); got != test.wantErrString {
+			t.Errorf("status %v: Error() = %q, want %q", test.statusCode, got, test.wantErrString)
+		}
+	}
+}
+
+func TestUnauthenticatedRequest(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	if _, err := client.Accounts(context.Background()); err != ErrUnauthenticatedRequest {
+		t.Errorf("Accounts error = %v, want ErrUnauthenticatedRequest", err)
+	}
+}
+
+func TestTransactionByID(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/transactions/tx_1":
+			w.Write([]byte(`{"transaction":{"id":"tx_1","amount":-1250}}`))
+		case "/transactions/tx_403":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"code":"forbidden.verification_required","message":"Verification required"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"not_found","message":"Transaction not found"}`))
+		}
+	}))
+	ctx := context.Background()
+
+	tnx, err := client.TransactionByID(ctx, "acc_1", "tx_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tnx.ID != "tx_1" || tnx.Amount != -1250 {
+		t.Errorf("TransactionByID = %+v, want tx_1 of -1250", tnx)
+	}
+
+	if _, err := client.TransactionByID(ctx, "acc_1", "tx_missing"); err != ErrNoTransactionFound {
+		t.Errorf("TransactionByID of a missing transaction error = %v, want ErrNoTransactionFound", err)
+	}
+
+	_, err = client.TransactionByID(ctx, "acc_1", "tx_403")
+	if apiErr, ok := err.(*APIError); !ok || !apiErr.IsForbidden() {
+		t.Errorf("TransactionByID of a forbidden transaction error = %v, want forbidden APIError", err)
+	}
+}
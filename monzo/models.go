@@ -22,21 +22,32 @@ type Account struct {
 }
 
 type Transaction struct {
+	AccountID      string                 `json:"account_id"`
 	AccountBalance int                    `json:"account_balance"`
 	Amount         int                    `json:"amount"`
-	Attachments    []interface{}          `json:"attachments"`
+	Attachments    []Attachment           `json:"attachments"`
 	Category       string                 `json:"category"`
+	Counterparty   Counterparty           `json:"counterparty"`
 	Created        string                 `json:"created"`
 	Currency       string                 `json:"currency"`
 	Description    string                 `json:"description"`
 	ID             string                 `json:"id"`
 	IsLoad         bool                   `json:"is_load"`
+	LocalAmount    int                    `json:"local_amount"`
+	LocalCurrency  string                 `json:"local_currency"`
 	Merchant       Merchant               `json:"merchant"`
 	Metadata       map[string]interface{} `json:"metadata"`
 	Notes          string                 `json:"notes"`
 	Settled        string                 `json:"settled"`
 }
 
+type Counterparty struct {
+	AccountNumber string `json:"account_number"`
+	Name          string `json:"name"`
+	SortCode      string `json:"sort_code"`
+	UserID        string `json:"user_id"`
+}
+
 type Merchant struct {
 	Address  MerchantAddress `json:"address"`
 	Category string          `json:"category"`
@@ -4,8 +4,10 @@
 package monzo
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -14,13 +16,15 @@ import (
 )
 
 const (
-	// The root URL we will base all queries off of. Currently only production is supported.
-	baseMonzoURL = "https://api.monzo.com"
+	// DefaultBaseURL is the root URL of the Monzo API, used unless a client sets BaseURL
+	DefaultBaseURL = "https://api.monzo.com"
 	// OAuth response type
 	responseType = "code"
 	// OAuth grant types
 	grantTypeRefresh  = "refresh_token"
 	grantTypeAuthCode = "authorization_code"
+	// Maximum number of transactions returned by a single transactions request
+	transactionsPageSize = 100
 )
 
 var (
@@ -34,11 +38,15 @@ var (
 
 // MonzoClient stores authentication data required for API calls
 type MonzoClient struct {
-	AccessToken   string
-	RefreshToken  string
-	ClientID      string
-	ClientSecret  string
-	ExpiryTime    time.Time
+	AccessToken  string
+	RefreshToken string
+	ClientID     string
+	ClientSecret string
+	ExpiryTime   time.Time
+	// BaseURL is the root URL of the API, DefaultBaseURL if empty
+	BaseURL string `json:",omitempty"`
+	// HTTPClient sends requests, http.DefaultClient if nil
+	HTTPClient    *http.Client `json:"-"`
 	authenticated bool
 }
 
@@ -47,69 +55,45 @@ func GetMonzoAuthURL(clientID, redirectURI string) string {
 	return fmt.Sprintf("https://auth.monzo.com/?client_id=%s&redirect_uri=%s&response_type=%s", clientID, redirectURI, responseType)
 }
 
-// ExchangeAuth exchanges the OAuth code for an access token and refresh token
-func ExchangeAuth(clientID, clientSecret, redirectURI, code string) (*MonzoClient, error) {
-	if clientID == "" || clientSecret == "" || redirectURI == "" || code == "" {
-		return nil, fmt.Errorf("zero value passed to ExchangeAuth")
+// ExchangeAuth exchanges the OAuth code for an access token and refresh token,
+// using the client's ClientID and ClientSecret
+func (m *MonzoClient) ExchangeAuth(ctx context.Context, redirectURI, code string) error {
+	if m.ClientID == "" || m.ClientSecret == "" || redirectURI == "" || code == "" {
+		return fmt.Errorf("zero value passed to ExchangeAuth")
 	}
 
-	values := url.Values{}
-	values.Set("grant_type", grantTypeAuthCode)
-	values.Set("client_id", clientID)
-	values.Set("client_secret", clientSecret)
-	values.Set("redirect_uri", redirectURI)
-	values.Set("code", code)
-
-	resp, err := http.PostForm(buildURL("oauth2/token"), values)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 401 {
-		return nil, ErrUnauthenticatedRequest
-	}
-
-	response := tokenResponse{}
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := json.Unmarshal(b, &response); err != nil {
-		return nil, err
-	}
-
-	if response.Error != "" {
-		return nil, fmt.Errorf(response.Error)
-	}
-
-	if response.ExpiresIn == 0 || response.TokenType == "" || response.AccessToken == "" {
-		return nil, fmt.Errorf("failed to scan response correctly")
+	params := map[string]string{
+		"grant_type":    grantTypeAuthCode,
+		"client_id":     m.ClientID,
+		"client_secret": m.ClientSecret,
+		"redirect_uri":  redirectURI,
+		"code":          code,
 	}
-
-	return &MonzoClient{
-		authenticated: true,
-		AccessToken:   response.AccessToken,
-		RefreshToken:  response.RefreshToken,
-		ExpiryTime:    time.Now().Add(time.Duration(response.ExpiresIn) * time.Second),
-		ClientID:      clientID,
-		ClientSecret:  clientSecret,
-	}, nil
+	return m.requestToken(ctx, params)
 }
 
 // RefreshAccessToken refreshes the access token using the refresh token
-func (m *MonzoClient) RefreshAccessToken() error {
+func (m *MonzoClient) RefreshAccessToken(ctx context.Context) error {
 	if m.RefreshToken == "" {
 		return ErrNoRefreshToken
 	}
-	values := url.Values{}
-	values.Set("grant_type", grantTypeRefresh)
-	values.Set("client_id", m.ClientID)
-	values.Set("client_secret", m.ClientSecret)
-	values.Set("refresh_token", m.RefreshToken)
 
-	resp, err := http.PostForm(buildURL("oauth2/token"), values)
+	params := map[string]string{
+		"grant_type":    grantTypeRefresh,
+		"client_id":     m.ClientID,
+		"client_secret": m.ClientSecret,
+		"refresh_token": m.RefreshToken,
+	}
+	return m.requestToken(ctx, params)
+}
+
+// requestToken requests a new access token with an OAuth grant
+func (m *MonzoClient) requestToken(ctx context.Context, params map[string]string) error {
+	req, err := m.newRequest(ctx, "POST", "oauth2/token", params)
+	if err != nil {
+		return err
+	}
+	resp, err := m.httpClient().Do(req)
 	if err != nil {
 		return err
 	}
@@ -118,6 +102,10 @@ func (m *MonzoClient) RefreshAccessToken() error {
 	if resp.StatusCode == 401 {
 		return ErrUnauthenticatedRequest
 	}
+	if resp.StatusCode == 429 || resp.StatusCode >= 500 {
+		// Other errors are described by the token response
+		return checkResponse(resp)
+	}
 
 	response := tokenResponse{}
 	b, err := ioutil.ReadAll(resp.Body)
@@ -160,68 +148,72 @@ func (m *MonzoClient) Authenticated() bool {
 }
 
 // callWithAuth makes authenticated calls to the Monzo API.
-func (m *MonzoClient) callWithAuth(methodType, URL string, params map[string]string) (*http.Response, error) {
-	var resp *http.Response
-	var err error
-
-	// TODO: This is so hacky, clean up
-	switch methodType {
-	case "GET":
-		req, err := http.NewRequest(methodType, buildURL(URL), nil)
-		if err != nil {
-			return nil, err
-		}
+func (m *MonzoClient) callWithAuth(ctx context.Context, method, path string, params map[string]string) (*http.Response, error) {
+	req, err := m.newRequest(ctx, method, path, params)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", m.AccessToken))
 
-		// If we have any parameters, add them here.
-		if len(params) > 0 {
-			query := req.URL.Query()
-			for k, v := range params {
-				query.Add(k, v)
-			}
-			req.URL.RawQuery = query.Encode()
-		}
+	resp, err := m.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
 
-		req.Header.Add("Authorization", fmt.Sprintf("Bearer %v", m.AccessToken))
-		resp, err = http.DefaultClient.Do(req)
-		if err != nil {
-			return nil, err
-		}
+	if resp.StatusCode == 401 {
+		resp.Body.Close()
+		m.authenticated = false
+		return nil, ErrUnauthenticatedRequest
+	}
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
 
-		if resp.StatusCode == 401 {
-			m.authenticated = false
-			return nil, ErrUnauthenticatedRequest
-		}
+	return resp, nil
+}
 
-	case "POST":
+// newRequest builds a request to path. Parameters are sent in the query of
+// GET and DELETE requests, and as a form in the body of any other request.
+func (m *MonzoClient) newRequest(ctx context.Context, method, path string, params map[string]string) (*http.Request, error) {
+	var body io.Reader
+	if method != "GET" && method != "DELETE" {
 		form := url.Values{}
 		for k, v := range params {
 			form.Set(k, v)
 		}
+		body = strings.NewReader(form.Encode())
+	}
 
-		req, err := http.NewRequest(methodType, buildURL(URL), strings.NewReader(form.Encode()))
-		if err != nil {
-			return nil, err
-		}
-
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-		req.Header.Add("Authorization", fmt.Sprintf("Bearer %v", m.AccessToken))
-		resp, err = http.DefaultClient.Do(req)
-		if err != nil {
-			return nil, err
-		}
+	req, err := http.NewRequest(method, m.buildURL(path), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
 
-		if resp.StatusCode == 401 {
-			m.authenticated = false
-			return nil, ErrUnauthenticatedRequest
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else if len(params) > 0 {
+		// If we have any parameters, add them here.
+		query := req.URL.Query()
+		for k, v := range params {
+			query.Add(k, v)
 		}
+		req.URL.RawQuery = query.Encode()
 	}
 
-	return resp, err
+	return req, nil
+}
+
+func (m *MonzoClient) httpClient() *http.Client {
+	if m.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return m.HTTPClient
 }
 
 // Transactions returns a slice of Transactions, with the merchant expanded within the Transaction.
 // This endpoint supports pagination. To paginate, provide the last Transacation.ID to the since parameter of the function, if the length of the results that are returned is equal to your limit.
-func (m *MonzoClient) Transactions(accountID, since, before string, limit int) ([]Transaction, error) {
+func (m *MonzoClient) Transactions(ctx context.Context, accountID, since, before string, limit int) ([]Transaction, error) {
 	type transactionsResponse struct {
 		Transactions []Transaction `json:"transactions"`
 	}
@@ -234,7 +226,7 @@ func (m *MonzoClient) Transactions(accountID, since, before string, limit int) (
 		"before":     before,
 	}
 
-	resp, err := m.callWithAuth("GET", "transactions", params)
+	resp, err := m.callWithAuth(ctx, "GET", "transactions", params)
 	if err != nil {
 		return nil, err
 	}
@@ -249,8 +241,27 @@ func (m *MonzoClient) Transactions(accountID, since, before string, limit int) (
 	return response.Transactions, nil
 }
 
+// AllTransactions returns every Transaction created after since (and before before, if set),
+// following the since/ID pagination cursor until the final page is reached.
+// since may be an RFC3339 timestamp or a transaction ID.
+func (m *MonzoClient) AllTransactions(ctx context.Context, accountID, since, before string) ([]Transaction, error) {
+	var transactions []Transaction
+	cursor := since
+	for {
+		page, err := m.Transactions(ctx, accountID, cursor, before, transactionsPageSize)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, page...)
+		if len(page) < transactionsPageSize {
+			return transactions, nil
+		}
+		cursor = page[len(page)-1].ID
+	}
+}
+
 // TransactionByID obtains a Monzo Transaction by a specific transaction ID.
-func (m *MonzoClient) TransactionByID(accountID, transactionID string) (*Transaction, error) {
+func (m *MonzoClient) TransactionByID(ctx context.Context, accountID, transactionID string) (*Transaction, error) {
 	type transactionByIDResponse struct {
 		Transaction Transaction `json:"transaction"`
 	}
@@ -260,16 +271,15 @@ func (m *MonzoClient) TransactionByID(accountID, transactionID string) (*Transac
 		"expand[]":   "merchant",
 	}
 
-	resp, err := m.callWithAuth("GET", fmt.Sprintf("transactions/%s", transactionID), params)
+	resp, err := m.callWithAuth(ctx, "GET", fmt.Sprintf("transactions/%s", transactionID), params)
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == 404 {
+		return nil, ErrNoTransactionFound
+	}
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == 404 {
-		return nil, ErrNoTransactionFound
-	}
-
 	response := transactionByIDResponse{}
 	b, err := ioutil.ReadAll(resp.Body)
 	if err := json.Unmarshal(b, &response); err != nil {
@@ -280,12 +290,12 @@ func (m *MonzoClient) TransactionByID(accountID, transactionID string) (*Transac
 }
 
 // Accounts returns a list of accounts
-func (m *MonzoClient) Accounts() ([]Account, error) {
+func (m *MonzoClient) Accounts(ctx context.Context) ([]Account, error) {
 	type accountsResponse struct {
 		Accounts []Account `json:"accounts"`
 	}
 
-	resp, err := m.callWithAuth("GET", "accounts", nil)
+	resp, err := m.callWithAuth(ctx, "GET", "accounts", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -300,6 +310,89 @@ func (m *MonzoClient) Accounts() ([]Account, error) {
 	return acresp.Accounts, nil
 }
 
-func buildURL(path string) string {
-	return fmt.Sprintf("%v/%v", baseMonzoURL, path)
+// Webhooks returns the webhooks registered for an account
+func (m *MonzoClient) Webhooks(ctx context.Context, accountID string) ([]Webhook, error) {
+	type webhooksResponse struct {
+		Webhooks []Webhook `json:"webhooks"`
+	}
+
+	params := map[string]string{
+		"account_id": accountID,
+	}
+
+	resp, err := m.callWithAuth(ctx, "GET", "webhooks", params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	response := webhooksResponse{}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(b, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Webhooks, nil
+}
+
+// RegisterWebhook registers a webhook that Monzo will post account events to
+func (m *MonzoClient) RegisterWebhook(ctx context.Context, accountID, webhookURL string) (*Webhook, error) {
+	type registerWebhookResponse struct {
+		Webhook Webhook `json:"webhook"`
+	}
+
+	params := map[string]string{
+		"account_id": accountID,
+		"url":        webhookURL,
+	}
+
+	resp, err := m.callWithAuth(ctx, "POST", "webhooks", params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	response := registerWebhookResponse{}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(b, &response); err != nil {
+		return nil, err
+	}
+
+	return &response.Webhook, nil
+}
+
+// DeleteWebhook deletes a webhook, stopping further events from being sent to it
+func (m *MonzoClient) DeleteWebhook(ctx context.Context, webhookID string) error {
+	resp, err := m.callWithAuth(ctx, "DELETE", fmt.Sprintf("webhooks/%s", webhookID), nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// DownloadAttachment downloads the file of an attachment, such as a receipt photo
+func (m *MonzoClient) DownloadAttachment(ctx context.Context, attachment Attachment) ([]byte, error) {
+	req, err := http.NewRequest("GET", attachment.FileUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to download attachment %s: %s", attachment.Id, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (m *MonzoClient) buildURL(path string) string {
+	baseURL := m.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return fmt.Sprintf("%v/%v", strings.TrimSuffix(baseURL, "/"), path)
 }
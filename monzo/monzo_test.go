@@ -0,0 +1,112 @@
+package monzo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newTestClient returns a client that sends requests to handler.
+func newTestClient(t *testing.T, handler http.Handler) *MonzoClient {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return &MonzoClient{AccessToken: "token", BaseURL: srv.URL, HTTPClient: srv.Client()}
+}
+
+// transactionsHandler serves count transactions, paginated like Monzo by the
+// ID of the last transaction of the previous page.
+func transactionsHandler(t *testing.T, count int, sinces *[]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/transactions" {
+			t.Errorf("request to %v, want /transactions", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q, want Bearer token", got)
+		}
+		query := r.URL.Query()
+		if got := query.Get("account_id"); got != "acc_1" {
+			t.Errorf("account_id = %q, want acc_1", got)
+		}
+		since := query.Get("since")
+		*sinces = append(*sinces, since)
+
+		start := 0
+		if strings.HasPrefix(since, "tx_") {
+			index, err := strconv.Atoi(strings.TrimPrefix(since, "tx_"))
+			if err != nil {
+				t.Errorf("invalid since %q", since)
+			}
+			start = index + 1
+		}
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		transactions := []Transaction{}
+		for i := start; i < start+limit && i < count; i++ {
+			transactions = append(transactions, Transaction{ID: fmt.Sprintf("tx_%03d", i)})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"transactions": transactions})
+	}
+}
+
+func TestAllTransactions(t *testing.T) {
+	tests := []struct {
+		count      int
+		wantSinces []string
+	}{
+		{0, []string{"2019-01-01T00:00:00Z"}},
+		{99, []string{"2019-01-01T00:00:00Z"}},
+		// A full page needs one more request to find that it's the last
+		{100, []string{"2019-01-01T00:00:00Z", "tx_099"}},
+		{101, []string{"2019-01-01T00:00:00Z", "tx_099"}},
+		{250, []string{"2019-01-01T00:00:00Z", "tx_099", "tx_199"}},
+	}
+	for _, test := range tests {
+		var sinces []string
+		client := newTestClient(t, transactionsHandler(t, test.count, &sinces))
+
+		transactions, err := client.AllTransactions(context.Background(), "acc_1", "2019-01-01T00:00:00Z", "")
+		if err != nil {
+			t.Fatalf("AllTransactions of %v transactions failed: %v", test.count, err)
+		}
+		if len(transactions) != test.count {
+			t.Errorf("AllTransactions returned %v transactions, want %v", len(transactions), test.count)
+		}
+		for i, tnx := range transactions {
+			if want := fmt.Sprintf("tx_%03d", i); tnx.ID != want {
+				t.Errorf("transaction %v has ID %v, want %v", i, tnx.ID, want)
+				break
+			}
+		}
+		if strings.Join(sinces, ",") != strings.Join(test.wantSinces, ",") {
+			t.Errorf("AllTransactions of %v transactions requested since %v, want %v", test.count, sinces, test.wantSinces)
+		}
+	}
+}
+
+func TestAllTransactionsError(t *testing.T) {
+	var requests int
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		transactions := make([]Transaction, transactionsPageSize)
+		for i := range transactions {
+			transactions[i].ID = fmt.Sprintf("tx_%03d", i)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"transactions": transactions})
+	}))
+
+	transactions, err := client.AllTransactions(context.Background(), "acc_1", "", "")
+	if err == nil {
+		t.Fatalf("AllTransactions returned %v transactions, want error", len(transactions))
+	}
+	if transactions != nil {
+		t.Errorf("AllTransactions returned %v transactions with error, want none", len(transactions))
+	}
+}
@@ -2,6 +2,6 @@
 
 while true; do 
     echo "Running at $(date)."
-    go run app/main.go
+    go run ./app
     sleep 300
 done
\ No newline at end of file
@@ -0,0 +1,50 @@
+package splitwise
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rhymond/go-money"
+)
+
+// CurrencyExponent returns the number of decimal places in the minor unit of
+// a currency, e.g. 2 for GBP and 0 for JPY.
+func CurrencyExponent(currencyCode string) (int, error) {
+	currency := money.GetCurrency(strings.ToUpper(currencyCode))
+	if currency == nil {
+		return 0, fmt.Errorf("unknown currency %q", currencyCode)
+	}
+	return currency.Fraction, nil
+}
+
+// FormatAmount formats an amount in minor units of a currency as an exact
+// decimal string, e.g. 1234 GBP is "12.34".
+func FormatAmount(amount int64, currencyCode string) (string, error) {
+	exponent, err := CurrencyExponent(currencyCode)
+	if err != nil {
+		return "", err
+	}
+	return formatDecimal(amount, exponent), nil
+}
+
+// ParseAmount parses a decimal amount such as the cost of an Expense into
+// minor units of a currency, e.g. "12.34" GBP is 1234.
+func ParseAmount(amount, currencyCode string) (int64, error) {
+	exponent, err := CurrencyExponent(currencyCode)
+	if err != nil {
+		return 0, err
+	}
+	negative := strings.HasPrefix(amount, "-")
+	value, places, err := parseDecimal(strings.TrimPrefix(amount, "-"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %v", amount, err)
+	}
+	if places > exponent {
+		return 0, fmt.Errorf("amount %q has too many decimal places for %v", amount, currencyCode)
+	}
+	value = scale(value, exponent-places)
+	if negative {
+		value = -value
+	}
+	return value, nil
+}
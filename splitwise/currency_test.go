@@ -0,0 +1,110 @@
+package splitwise
+
+import "testing"
+
+func TestCurrencyExponent(t *testing.T) {
+	tests := []struct {
+		currencyCode string
+		want         int
+		wantErr      bool
+	}{
+		{"GBP", 2, false},
+		{"gbp", 2, false},
+		{"JPY", 0, false},
+		{"KWD", 3, false},
+		{"XYZ", 0, true},
+		{"", 0, true},
+	}
+	for _, test := range tests {
+		got, err := CurrencyExponent(test.currencyCode)
+		if (err != nil) != test.wantErr {
+			t.Errorf("CurrencyExponent(%q) error = %v, want error %v", test.currencyCode, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("CurrencyExponent(%q) = %v, want %v", test.currencyCode, got, test.want)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount       int64
+		currencyCode string
+		want         string
+		wantErr      bool
+	}{
+		{1234, "GBP", "12.34", false},
+		{5, "GBP", "0.05", false},
+		{0, "GBP", "0.00", false},
+		{-1234, "GBP", "-12.34", false},
+		{-5, "GBP", "-0.05", false},
+		{500, "JPY", "500", false},
+		{-500, "JPY", "-500", false},
+		{12345, "KWD", "12.345", false},
+		{7, "KWD", "0.007", false},
+		{-12345, "KWD", "-12.345", false},
+		{1234, "XYZ", "", true},
+	}
+	for _, test := range tests {
+		got, err := FormatAmount(test.amount, test.currencyCode)
+		if (err != nil) != test.wantErr {
+			t.Errorf("FormatAmount(%v, %q) error = %v, want error %v", test.amount, test.currencyCode, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("FormatAmount(%v, %q) = %q, want %q", test.amount, test.currencyCode, got, test.want)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		amount       string
+		currencyCode string
+		want         int64
+		wantErr      bool
+	}{
+		{"12.34", "GBP", 1234, false},
+		{"12.3", "GBP", 1230, false},
+		{"12", "GBP", 1200, false},
+		{".05", "GBP", 5, false},
+		{"-12.34", "GBP", -1234, false},
+		{"12.345", "GBP", 0, true},
+		{"500", "JPY", 500, false},
+		{"-500", "JPY", -500, false},
+		{"500.0", "JPY", 0, true},
+		{"12.345", "KWD", 12345, false},
+		{"12.3", "KWD", 12300, false},
+		{"-0.007", "KWD", -7, false},
+		{"12.3456", "KWD", 0, true},
+		{"12.34", "XYZ", 0, true},
+		{"abc", "GBP", 0, true},
+		{"", "GBP", 0, true},
+	}
+	for _, test := range tests {
+		got, err := ParseAmount(test.amount, test.currencyCode)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseAmount(%q, %q) error = %v, want error %v", test.amount, test.currencyCode, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseAmount(%q, %q) = %v, want %v", test.amount, test.currencyCode, got, test.want)
+		}
+	}
+}
+
+func TestParseFormatAmountRoundTrip(t *testing.T) {
+	for _, currencyCode := range []string{"GBP", "JPY", "KWD"} {
+		for _, amount := range []int64{0, 1, -1, 99, 1000, -123456} {
+			formatted, err := FormatAmount(amount, currencyCode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := ParseAmount(formatted, currencyCode)
+			if err != nil || parsed != amount {
+				t.Errorf("ParseAmount(%q, %q) = %v, %v, want %v", formatted, currencyCode, parsed, err, amount)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package splitwise
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// APIError is an error response from the Splitwise API. Splitwise reports
+// some errors, such as invalid expenses, with a successful status code.
+type APIError struct {
+	StatusCode int
+	// Errors are Splitwise's messages keyed by the field they are about, or
+	// "base" for errors about the whole request
+	Errors map[string][]string
+}
+
+func (e *APIError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("splitwise: %v %v", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	fields := make([]string, 0, len(e.Errors))
+	for field := range e.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	var messages []string
+	for _, field := range fields {
+		message := strings.Join(e.Errors[field], ", ")
+		if field != "base" {
+			message = field + ": " + message
+		}
+		messages = append(messages, message)
+	}
+	return fmt.Sprintf("splitwise: %v", strings.Join(messages, "; "))
+}
+
+// checkResponse returns an APIError if a response body has an unsuccessful
+// status code or reports errors.
+func checkResponse(statusCode int, body []byte) error {
+	type errorResponse struct {
+		Error  string          `json:"error"`
+		Errors json.RawMessage `json:"errors"`
+	}
+	response := errorResponse{}
+	// Bodies that aren't JSON are only checked by status code
+	json.Unmarshal(body, &response)
+
+	apiErr := &APIError{StatusCode: statusCode, Errors: parseErrors(response.Errors)}
+	if response.Error != "" {
+		apiErr.Errors["base"] = append(apiErr.Errors["base"], response.Error)
+	}
+	if len(apiErr.Errors) == 0 && statusCode >= 200 && statusCode < 300 {
+		return nil
+	}
+	return apiErr
+}
+
+// parseErrors parses the errors Splitwise returns, which are either keyed by
+// field or a list of messages about the whole request.
+func parseErrors(raw json.RawMessage) map[string][]string {
+	errors := map[string][]string{}
+	if len(raw) == 0 {
+		return errors
+	}
+
+	byField := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &byField); err == nil {
+		for field, value := range byField {
+			if messages := parseMessages(value); len(messages) > 0 {
+				errors[field] = messages
+			}
+		}
+		return errors
+	}
+	if messages := parseMessages(raw); len(messages) > 0 {
+		errors["base"] = messages
+	}
+	return errors
+}
+
+// parseMessages parses a single error message or a list of them.
+func parseMessages(raw json.RawMessage) []string {
+	var messages []string
+	if err := json.Unmarshal(raw, &messages); err == nil {
+		return messages
+	}
+	var message string
+	if err := json.Unmarshal(raw, &message); err == nil && message != "" {
+		return []string{message}
+	}
+	return nil
+}
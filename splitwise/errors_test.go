@@ -0,0 +1,87 @@
+package splitwise
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		body       string
+		// want is nil if no error is expected
+		want map[string][]string
+	}{
+		{200, `{"expenses":[]}`, nil},
+		{200, `{"expenses":[],"errors":{}}`, nil},
+		{200, `{"expenses":[],"errors":[]}`, nil},
+		{200, `{"errors":{"base":["Invalid split"]}}`, map[string][]string{"base": {"Invalid split"}}},
+		{200, `{"errors":{"cost":["must be positive"],"date":"is invalid"}}`,
+			map[string][]string{"cost": {"must be positive"}, "date": {"is invalid"}}},
+		{200, `{"errors":["a","b"]}`, map[string][]string{"base": {"a", "b"}}},
+		{400, `{"errors":"bad request"}`, map[string][]string{"base": {"bad request"}}},
+		{401, `{"error":"Invalid API Request: you are not logged in"}`,
+			map[string][]string{"base": {"Invalid API Request: you are not logged in"}}},
+		{404, `{"errors":{}}`, map[string][]string{}},
+		{500, `<html>Internal Server Error</html>`, map[string][]string{}},
+	}
+	for _, test := range tests {
+		err := checkResponse(test.statusCode, []byte(test.body))
+		if test.want == nil {
+			if err != nil {
+				t.Errorf("checkResponse(%v, %s) = %v, want nil", test.statusCode, test.body, err)
+			}
+			continue
+		}
+		apiErr, ok := err.(*APIError)
+		if !ok {
+			t.Errorf("checkResponse(%v, %s) = %#v, want *APIError", test.statusCode, test.body, err)
+			continue
+		}
+		if apiErr.StatusCode != test.statusCode || !reflect.DeepEqual(apiErr.Errors, test.want) {
+			t.Errorf("checkResponse(%v, %s) = %+v, want errors %v", test.statusCode, test.body, apiErr, test.want)
+		}
+	}
+}
+
+func TestAPIErrorMessage(t *testing.T) {
+	tests := []struct {
+		err  APIError
+		want string
+	}{
+		{APIError{StatusCode: 500}, "splitwise: 500 Internal Server Error"},
+		{APIError{StatusCode: 200, Errors: map[string][]string{"base": {"Invalid split"}}}, "splitwise: Invalid split"},
+		{APIError{StatusCode: 200, Errors: map[string][]string{"date": {"is invalid"}, "cost": {"a", "b"}}},
+			"splitwise: cost: a, b; date: is invalid"},
+	}
+	for _, test := range tests {
+		if got := test.err.Error(); got != test.want {
+			t.Errorf("%+v.Error() = %q, want %q", test.err, got, test.want)
+		}
+	}
+}
+
+func TestAddExpenseError(t *testing.T) {
+	// Invalid expenses are reported with a successful status code and no expense
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"expenses":[],"errors":{"cost":["must be greater than 0"]}}`))
+	}))
+
+	expense, err := client.AddExpense(ExpenseRequest{
+		Cost:         1000,
+		CurrencyCode: "GBP",
+		Self:         "1",
+		Users:        []string{"1", "2"},
+	})
+	if expense != nil {
+		t.Errorf("AddExpense returned expense %+v, want nil", expense)
+	}
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("AddExpense error = %#v, want *APIError", err)
+	}
+	if want := map[string][]string{"cost": {"must be greater than 0"}}; !reflect.DeepEqual(apiErr.Errors, want) {
+		t.Errorf("AddExpense errors = %v, want %v", apiErr.Errors, want)
+	}
+}
@@ -57,6 +57,23 @@ type Group struct {
 	InviteLink        string        `json:"invite_link,omitempty"`
 }
 
+type Friend struct {
+	ID                 int    `json:"id"`
+	FirstName          string `json:"first_name"`
+	LastName           string `json:"last_name"`
+	Email              string `json:"email"`
+	RegistrationStatus string `json:"registration_status"`
+	Picture            struct {
+		Small  string `json:"small"`
+		Medium string `json:"medium"`
+		Large  string `json:"large"`
+	} `json:"picture"`
+	Groups []struct {
+		GroupID int `json:"group_id"`
+	} `json:"groups"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 type Expense struct {
 	ID                     int         `json:"id"`
 	GroupID                int         `json:"group_id"`
@@ -105,3 +122,25 @@ type Expense struct {
 		NetBalance string `json:"net_balance"`
 	} `json:"users"`
 }
+
+type Comment struct {
+	ID           int         `json:"id"`
+	Content      string      `json:"content"`
+	CommentType  string      `json:"comment_type"`
+	RelationType string      `json:"relation_type"`
+	RelationID   int         `json:"relation_id"`
+	CreatedAt    time.Time   `json:"created_at"`
+	DeletedAt    interface{} `json:"deleted_at"`
+	User         struct {
+		ID        int    `json:"id"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+	} `json:"user"`
+}
+
+type Category struct {
+	ID            int        `json:"id"`
+	Name          string     `json:"name"`
+	Icon          string     `json:"icon"`
+	Subcategories []Category `json:"subcategories"`
+}
@@ -0,0 +1,272 @@
+package splitwise
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// currencySymbols may prefix exact amounts in a split
+const currencySymbols = "£$€¥"
+
+// SplitKind is how the cost of an expense is divided between its users
+type SplitKind int
+
+const (
+	// SplitEqual divides the cost equally between all users
+	SplitEqual SplitKind = iota
+	// SplitShares divides the cost in proportion to each user's shares
+	SplitShares
+	// SplitPercent gives each user a percentage of the cost
+	SplitPercent
+	// SplitExact gives each user an exact amount of the cost
+	SplitExact
+)
+
+// SplitEntry is a single user's part of a Split
+type SplitEntry struct {
+	// Rest entries take an equal part of whatever the other entries leave.
+	// For SplitShares, this is a single share.
+	Rest bool
+	// Value is a number of shares, a percentage or an amount, stored as
+	// Value / 10^Places.
+	Value  int64
+	Places int
+}
+
+// Split describes how the cost of an expense is divided between its users.
+// Entries are in the same order as the users of the expense. The zero value
+// splits the cost equally.
+type Split struct {
+	Kind    SplitKind
+	Entries []SplitEntry
+}
+
+// ParseSplit parses a split of colon separated entries, one per user.
+// Entries are either all shares ("2:1:1"), all percentages ("60%:40%") or all
+// amounts with a decimal point or currency symbol ("12.50:7.50", "¥500:*").
+// Entries separated by slashes are percentages without the "%" ("60/40").
+// Percentages and amounts may use "*" for users who split whatever is left
+// equally.
+func ParseSplit(spec string) (Split, error) {
+	separator, percentages := ":", false
+	if strings.Contains(spec, "/") {
+		if strings.Contains(spec, ":") {
+			return Split{}, fmt.Errorf("split %q mixes \":\" and \"/\"", spec)
+		}
+		separator, percentages = "/", true
+	}
+
+	split := Split{}
+	for _, field := range strings.Split(spec, separator) {
+		if field == "*" {
+			split.Entries = append(split.Entries, SplitEntry{Rest: true})
+			continue
+		}
+
+		kind := SplitShares
+		switch {
+		case strings.HasSuffix(field, "%"):
+			kind = SplitPercent
+			field = strings.TrimSuffix(field, "%")
+		case percentages && strings.TrimLeft(field, currencySymbols) == field:
+			kind = SplitPercent
+		case strings.Contains(field, "."), strings.TrimLeft(field, currencySymbols) != field:
+			kind = SplitExact
+		}
+		if split.Kind != SplitEqual && split.Kind != kind {
+			return Split{}, fmt.Errorf("split %q mixes shares, percentages and amounts", spec)
+		}
+		split.Kind = kind
+
+		value, places, err := parseDecimal(field)
+		if err != nil {
+			return Split{}, fmt.Errorf("invalid split entry %q: %v", field, err)
+		}
+		split.Entries = append(split.Entries, SplitEntry{Value: value, Places: places})
+	}
+	if split.Kind == SplitEqual {
+		// Only "*" entries, which is an equal split
+		split.Entries = nil
+	}
+	return split, nil
+}
+
+// OwedShares divides cost, in minor units of a currency with the given number
+// of decimal places, between users. The returned shares always sum to cost.
+func (s Split) OwedShares(cost int64, exponent, users int) ([]int64, error) {
+	if users == 0 {
+		return nil, fmt.Errorf("no users to split between")
+	}
+	if s.Kind == SplitEqual || len(s.Entries) == 0 {
+		return allocate(cost, repeat(1, users)), nil
+	}
+	if len(s.Entries) != users {
+		return nil, fmt.Errorf("split has %v entries but there are %v users", len(s.Entries), users)
+	}
+
+	places := 0
+	rest := int64(0)
+	for _, entry := range s.Entries {
+		if entry.Rest {
+			rest++
+		} else if entry.Places > places {
+			places = entry.Places
+		}
+	}
+
+	switch s.Kind {
+	case SplitShares:
+		weights := make([]int64, users)
+		for i, entry := range s.Entries {
+			if entry.Rest {
+				weights[i] = pow10(places)
+			} else {
+				weights[i] = scale(entry.Value, places-entry.Places)
+			}
+		}
+		if sum(weights) == 0 {
+			return nil, fmt.Errorf("split has no shares")
+		}
+		return allocate(cost, weights), nil
+
+	case SplitPercent:
+		total := 100 * pow10(places)
+		weights := make([]int64, users)
+		for i, entry := range s.Entries {
+			if !entry.Rest {
+				weights[i] = scale(entry.Value, places-entry.Places)
+			}
+		}
+		fixed := sum(weights)
+		if fixed > total || (rest == 0 && fixed != total) {
+			return nil, fmt.Errorf("split percentages add up to %v%%, not 100%%", formatDecimal(fixed, places))
+		}
+		if rest > 0 {
+			// Scale fixed percentages so the remainder divides equally
+			for i, entry := range s.Entries {
+				if entry.Rest {
+					weights[i] = total - fixed
+				} else {
+					weights[i] *= rest
+				}
+			}
+		}
+		return allocate(cost, weights), nil
+
+	case SplitExact:
+		shares := make([]int64, users)
+		for i, entry := range s.Entries {
+			if entry.Rest {
+				continue
+			}
+			if entry.Places > exponent {
+				return nil, fmt.Errorf("split amount %v has too many decimal places", formatDecimal(entry.Value, entry.Places))
+			}
+			shares[i] = scale(entry.Value, exponent-entry.Places)
+		}
+		fixed := sum(shares)
+		if fixed > cost || (rest == 0 && fixed != cost) {
+			return nil, fmt.Errorf("split amounts add up to %v, not %v",
+				formatDecimal(fixed, exponent), formatDecimal(cost, exponent))
+		}
+		if rest > 0 {
+			restShares := allocate(cost-fixed, repeat(1, int(rest)))
+			for i, entry := range s.Entries {
+				if entry.Rest {
+					shares[i], restShares = restShares[0], restShares[1:]
+				}
+			}
+		}
+		return shares, nil
+	}
+
+	return nil, fmt.Errorf("unknown split kind %v", s.Kind)
+}
+
+// allocate divides total in proportion to weights, using the largest remainder
+// method so that the parts always sum to total. Ties go to earlier parts.
+func allocate(total int64, weights []int64) []int64 {
+	parts := make([]int64, len(weights))
+	remainders := make([]int64, len(weights))
+	totalWeight := sum(weights)
+	allocated := int64(0)
+	for i, w := range weights {
+		parts[i] = total * w / totalWeight
+		remainders[i] = total * w % totalWeight
+		allocated += parts[i]
+	}
+	for ; allocated < total; allocated++ {
+		largest := 0
+		for i := range remainders {
+			if remainders[i] > remainders[largest] {
+				largest = i
+			}
+		}
+		parts[largest]++
+		remainders[largest] = -1
+	}
+	return parts
+}
+
+// parseDecimal parses a non-negative decimal number such as "12.50" into its
+// unscaled value and number of decimal places. A leading currency symbol is ignored.
+func parseDecimal(s string) (int64, int, error) {
+	s = strings.TrimLeft(s, currencySymbols)
+	if s == "" {
+		return 0, 0, fmt.Errorf("empty value")
+	}
+	whole, fraction := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	value, err := strconv.ParseUint(whole+fraction, 10, 63)
+	if err != nil {
+		return 0, 0, fmt.Errorf("not a number")
+	}
+	return int64(value), len(fraction), nil
+}
+
+// formatDecimal formats value / 10^places as a decimal string.
+func formatDecimal(value int64, places int) string {
+	sign := ""
+	if value < 0 {
+		sign, value = "-", -value
+	}
+	if places == 0 {
+		return fmt.Sprintf("%v%v", sign, value)
+	}
+	unit := pow10(places)
+	return fmt.Sprintf("%v%v.%0*d", sign, value/unit, places, value%unit)
+}
+
+func pow10(n int) int64 {
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
+
+func scale(value int64, places int) int64 {
+	return value * pow10(places)
+}
+
+func sum(values []int64) int64 {
+	total := int64(0)
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func repeat(value int64, n int) []int64 {
+	values := make([]int64, n)
+	for i := range values {
+		values[i] = value
+	}
+	return values
+}
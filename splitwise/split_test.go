@@ -0,0 +1,146 @@
+package splitwise
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSplit(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Split
+		wantErr bool
+	}{
+		{"2:1:1", Split{SplitShares, []SplitEntry{{Value: 2}, {Value: 1}, {Value: 1}}}, false},
+		{"60%:*", Split{SplitPercent, []SplitEntry{{Value: 60}, {Rest: true}}}, false},
+		{"33.3%:*", Split{SplitPercent, []SplitEntry{{Value: 333, Places: 1}, {Rest: true}}}, false},
+		{"12.50:*", Split{SplitExact, []SplitEntry{{Value: 1250, Places: 2}, {Rest: true}}}, false},
+		{"¥500:*", Split{SplitExact, []SplitEntry{{Value: 500}, {Rest: true}}}, false},
+		{"*:*", Split{SplitEqual, nil}, false},
+		{"60/40", Split{SplitPercent, []SplitEntry{{Value: 60}, {Value: 40}}}, false},
+		{"60%/40%", Split{SplitPercent, []SplitEntry{{Value: 60}, {Value: 40}}}, false},
+		{"33.3/*/*", Split{SplitPercent, []SplitEntry{{Value: 333, Places: 1}, {Rest: true}, {Rest: true}}}, false},
+		{"60/40:1", Split{}, true},
+		{"60/£40", Split{}, true},
+		{"60/", Split{}, true},
+		{"2:50%", Split{}, true},
+		{"1.50:2", Split{}, true},
+		{"abc", Split{}, true},
+		{"2::1", Split{}, true},
+	}
+	for _, test := range tests {
+		got, err := ParseSplit(test.spec)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseSplit(%q) error = %v, want error %v", test.spec, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseSplit(%q) = %+v, want %+v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestOwedShares(t *testing.T) {
+	tests := []struct {
+		spec     string
+		cost     int64
+		exponent int
+		users    int
+		want     []int64
+		wantErr  bool
+	}{
+		// Equal splits give the remainder to the earliest users
+		{"", 1000, 2, 3, []int64{334, 333, 333}, false},
+		{"*:*:*", 1001, 2, 3, []int64{334, 334, 333}, false},
+		{"2:1:1", 1000, 2, 3, []int64{500, 250, 250}, false},
+		{"1:1:1", 100, 2, 3, []int64{34, 33, 33}, false},
+		{"0:0", 100, 2, 2, nil, true},
+		{"50%:*:*", 1000, 2, 3, []int64{500, 250, 250}, false},
+		{"33.3%:*", 1000, 2, 2, []int64{333, 667}, false},
+		{"25%:25%:50%", 999, 2, 3, []int64{250, 250, 499}, false},
+		{"60%:30%", 1000, 2, 2, nil, true},
+		{"60/40", 1000, 2, 2, []int64{600, 400}, false},
+		{"50/*/*", 1000, 2, 3, []int64{500, 250, 250}, false},
+		{"60/30", 1000, 2, 2, nil, true},
+		{"60%:50%:*", 1000, 2, 3, nil, true},
+		{"12.50:*:*", 2000, 2, 3, []int64{1250, 375, 375}, false},
+		{"*:12.50:*", 2001, 2, 3, []int64{376, 1250, 375}, false},
+		{"¥500:*", 1001, 0, 2, []int64{500, 501}, false},
+		{"10.00:10.00", 2000, 2, 2, []int64{1000, 1000}, false},
+		// Amounts can't be more precise than the currency
+		{"1.005:*", 2000, 2, 2, nil, true},
+		{"¥1.5:*", 1000, 0, 2, nil, true},
+		{"10.00:5.00", 2000, 2, 2, nil, true},
+		{"25.00:*", 2000, 2, 2, nil, true},
+		{"2:1", 1000, 2, 3, nil, true},
+		{"", 1000, 2, 0, nil, true},
+	}
+	for _, test := range tests {
+		split := Split{}
+		if test.spec != "" {
+			var err error
+			split, err = ParseSplit(test.spec)
+			if err != nil {
+				t.Fatalf("ParseSplit(%q) failed: %v", test.spec, err)
+			}
+		}
+		got, err := split.OwedShares(test.cost, test.exponent, test.users)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q.OwedShares(%v) error = %v, want error %v", test.spec, test.cost, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q.OwedShares(%v) = %v, want %v", test.spec, test.cost, got, test.want)
+		}
+	}
+}
+
+func TestOwedSharesSumToCost(t *testing.T) {
+	specs := []string{"", "2:1:1", "3:1:1", "7:5:3", "33.3%:*:*", "1%:*:*", "12.5%:37.5%:50%", "0.01:*:*"}
+	costs := []int64{1, 2, 7, 99, 100, 1001, 123457}
+	for _, spec := range specs {
+		split := Split{}
+		if spec != "" {
+			var err error
+			split, err = ParseSplit(spec)
+			if err != nil {
+				t.Fatalf("ParseSplit(%q) failed: %v", spec, err)
+			}
+		}
+		for _, cost := range costs {
+			shares, err := split.OwedShares(cost, 2, 3)
+			if err != nil {
+				t.Errorf("%q.OwedShares(%v) failed: %v", spec, cost, err)
+				continue
+			}
+			if sum(shares) != cost {
+				t.Errorf("%q.OwedShares(%v) = %v, which sums to %v", spec, cost, shares, sum(shares))
+			}
+			for _, share := range shares {
+				if share < 0 {
+					t.Errorf("%q.OwedShares(%v) = %v, which has a negative share", spec, cost, shares)
+				}
+			}
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		total   int64
+		weights []int64
+		want    []int64
+	}{
+		{10, []int64{1, 1, 1}, []int64{4, 3, 3}},
+		{0, []int64{1, 2}, []int64{0, 0}},
+		// The largest remainder gets the extra unit, not the first part
+		{10, []int64{1, 2}, []int64{3, 7}},
+		{5, []int64{0, 1}, []int64{0, 5}},
+	}
+	for _, test := range tests {
+		got := allocate(test.total, test.weights)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("allocate(%v, %v) = %v, want %v", test.total, test.weights, got, test.want)
+		}
+	}
+}
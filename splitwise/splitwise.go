@@ -1,26 +1,66 @@
 package splitwise
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"math"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"net/url"
 	"strings"
 
 	"github.com/dghubble/oauth1"
-	"github.com/rhymond/go-money"
 )
 
 const (
-	GetExpensesURL    = "https://secure.splitwise.com/api/v3.0/get_expenses"
-	GetGroupsURL      = "https://secure.splitwise.com/api/v3.0/get_groups"
-	CreateExpenseURL  = "https://secure.splitwise.com/api/v3.0/create_expense"
-	GetCurrentUserURL = "https://secure.splitwise.com/api/v3.0/get_current_user"
+	// DefaultBaseURL is the Splitwise API that clients call unless configured otherwise
+	DefaultBaseURL = "https://secure.splitwise.com/api/v3.0/"
+	// DefaultUserAgent is sent with requests unless configured otherwise
+	DefaultUserAgent = "monzosplitwise"
+
+	// Paths of API endpoints, relative to a client's BaseURL
+	GetExpensesPath    = "get_expenses"
+	GetGroupsPath      = "get_groups"
+	CreateExpensePath  = "create_expense"
+	GetCurrentUserPath = "get_current_user"
+	GetFriendsPath     = "get_friends"
+	GetExpensePath     = "get_expense"
+	UpdateExpensePath  = "update_expense"
+	CreateCommentPath  = "create_comment"
+	DeleteExpensePath  = "delete_expense"
+	GetCategoriesPath  = "get_categories"
+
+	// Number of expenses requested per page by GetAllExpenses
+	expensesPageSize = 100
 )
 
+// Client calls the Splitwise API
+type Client struct {
+	// HTTPClient sends requests, and is expected to sign them
+	HTTPClient *http.Client
+	// BaseURL is the URL that API paths are relative to, ending in a slash
+	BaseURL string
+	// UserAgent is sent with every request if not empty
+	UserAgent string
+	// Context is used for every request
+	Context context.Context
+}
+
+// NewClient returns a client for the Splitwise API, signing requests with the
+// OAuth token in config.
+func NewClient(ctx context.Context, config SplitwiseConfig) *Client {
+	return &Client{
+		HTTPClient: config.OAuthConfig.Client(ctx, &config.Token),
+		BaseURL:    DefaultBaseURL,
+		UserAgent:  DefaultUserAgent,
+		Context:    ctx,
+	}
+}
+
 // GetSplitwiseTokens interactively requests for an OAuth code and returns an access token
 func GetSplitwiseTokens(config oauth1.Config) (*oauth1.Token, error) {
 	// ctx := context.Background()
@@ -45,147 +85,255 @@ func GetSplitwiseTokens(config oauth1.Config) (*oauth1.Token, error) {
 	return oauth1.NewToken(accessToken, accessSecret), err
 }
 
-func GetExpenses(config SplitwiseConfig, groupID, datedAfter string, limit int) ([]Expense, error) {
-	type expensesResponse struct {
-		Expenses []Expense `json:"expenses"`
-	}
-
+func (c *Client) GetExpenses(groupID, datedAfter string, limit int) ([]Expense, error) {
 	params := map[string]string{
 		"limit":       fmt.Sprintf("%v", limit),
 		"dated_after": datedAfter,
 		"group_id":    groupID,
 	}
+	return c.getExpenses(params)
+}
 
-	ctx := context.Background()
-	httpClient := config.OAuthConfig.Client(ctx, &config.Token)
-
-	url, err := buildURLParams(GetExpensesURL, params)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := httpClient.Get(url)
-	if err != nil {
-		return nil, err
+// GetAllExpenses returns every expense dated between datedAfter and
+// datedBefore, paginating through the results. Empty dates are unbounded.
+func (c *Client) GetAllExpenses(groupID, datedAfter, datedBefore string) ([]Expense, error) {
+	var expenses []Expense
+	for {
+		params := map[string]string{
+			"limit":        fmt.Sprintf("%v", expensesPageSize),
+			"offset":       fmt.Sprintf("%v", len(expenses)),
+			"dated_after":  datedAfter,
+			"dated_before": datedBefore,
+			"group_id":     groupID,
+		}
+		page, err := c.getExpenses(params)
+		if err != nil {
+			return nil, err
+		}
+		expenses = append(expenses, page...)
+		if len(page) < expensesPageSize {
+			return expenses, nil
+		}
 	}
-	defer resp.Body.Close()
+}
 
+func (c *Client) getExpenses(params map[string]string) ([]Expense, error) {
+	type expensesResponse struct {
+		Expenses []Expense `json:"expenses"`
+	}
 	response := expensesResponse{}
-	b, err := ioutil.ReadAll(resp.Body)
-	if err := json.Unmarshal(b, &response); err != nil {
+	if err := c.get(GetExpensesPath, params, &response); err != nil {
 		return nil, err
 	}
-
 	return response.Expenses, nil
 }
 
-func GetGroups(config SplitwiseConfig) ([]Group, error) {
-	type groupsResponse struct {
-		Groups []Group `json:"groups"`
+func (c *Client) GetExpense(expenseID int) (*Expense, error) {
+	type expenseResponse struct {
+		Expense Expense `json:"expense"`
 	}
-	ctx := context.Background()
-	httpClient := config.OAuthConfig.Client(ctx, &config.Token)
-
-	resp, err := httpClient.Get(GetGroupsURL)
-	if err != nil {
+	response := expenseResponse{}
+	if err := c.get(fmt.Sprintf("%v/%v", GetExpensePath, expenseID), nil, &response); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return &response.Expense, nil
+}
 
+func (c *Client) GetGroups() ([]Group, error) {
+	type groupsResponse struct {
+		Groups []Group `json:"groups"`
+	}
 	response := groupsResponse{}
-	b, err := ioutil.ReadAll(resp.Body)
-	if err := json.Unmarshal(b, &response); err != nil {
+	if err := c.get(GetGroupsPath, nil, &response); err != nil {
 		return nil, err
 	}
-
 	return response.Groups, nil
 }
 
-func AddExpense(config SplitwiseConfig,
-	payment string, cost int, currencyCode, description, groupID, details, date,
-	creationMethod, self string, users []string) (*Expense, error) {
-	type expensesResponse struct {
-		Expenses []Expense `json:"expenses"`
-	}
-	ctx := context.Background()
-	httpClient := config.OAuthConfig.Client(ctx, &config.Token)
+// Receipt is an image file attached to an expense
+type Receipt struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
 
-	stringFullCost := fmt.Sprintf("%v", (math.Abs(float64(cost)) / 100.0))
-	costMoney := money.New(int64(cost), "GBP").Absolute()
-	userCount := len(users)
-	splits, err := costMoney.Split(userCount)
+// ExpenseRequest holds the details of an expense to be created
+type ExpenseRequest struct {
+	Payment string
+	// Cost is in minor units of CurrencyCode, and may be negative
+	Cost           int
+	CurrencyCode   string
+	Description    string
+	GroupID        string
+	Details        string
+	Date           string
+	CreationMethod string
+	// CategoryID is the Splitwise category of the expense, zero for none
+	CategoryID int
+	// Self is the ID of the user who paid for the expense
+	Self string
+	// Users are the IDs of the users the cost is split between
+	Users []string
+	// Split is how the cost is divided between Users
+	Split Split
+	// Reverse swaps the paid and owed shares, so that Self owes the cost and
+	// the split is paid back to Users. This is used for refunds.
+	Reverse bool
+	Receipt *Receipt
+}
+
+// Form returns the create_expense parameters for the expense, excluding the receipt
+func (e ExpenseRequest) Form() (url.Values, error) {
+	exponent, err := CurrencyExponent(e.CurrencyCode)
+	if err != nil {
+		return nil, err
+	}
+	cost := int64(e.Cost)
+	if cost < 0 {
+		cost = -cost
+	}
+	stringFullCost := formatDecimal(cost, exponent)
+	splits, err := e.Split.OwedShares(cost, exponent, len(e.Users))
 	if err != nil {
 		return nil, err
 	}
 
 	form := url.Values{}
-	form.Set("payment", payment)
+	form.Set("payment", e.Payment)
 	form.Set("cost", stringFullCost)
-	form.Set("currency_code", currencyCode)
-	form.Set("description", description)
-	form.Set("group_id", groupID)
-	form.Set("details", details)
-	form.Set("date", date)
-	form.Set("creation_method", creationMethod)
-
-	for i, user := range users {
+	form.Set("currency_code", e.CurrencyCode)
+	form.Set("description", e.Description)
+	form.Set("group_id", e.GroupID)
+	form.Set("details", e.Details)
+	form.Set("date", e.Date)
+	form.Set("creation_method", e.CreationMethod)
+	if e.CategoryID != 0 {
+		form.Set("category_id", fmt.Sprintf("%v", e.CategoryID))
+	}
+
+	paidKey, owedKey := "paid_share", "owed_share"
+	if e.Reverse {
+		paidKey, owedKey = owedKey, paidKey
+	}
+	for i, user := range e.Users {
 		form.Set(fmt.Sprintf("users__%v__user_id", i), user)
-		if user == self {
-			form.Set(fmt.Sprintf("users__%v__paid_share", i), stringFullCost)
+		if user == e.Self {
+			form.Set(fmt.Sprintf("users__%v__%v", i, paidKey), stringFullCost)
 		} else {
-			form.Set(fmt.Sprintf("users__%v__paid_share", i), "0")
+			form.Set(fmt.Sprintf("users__%v__%v", i, paidKey), formatDecimal(0, exponent))
 		}
-		form.Set(fmt.Sprintf("users__%v__owed_share", i), fmt.Sprintf("%v", (math.Abs(float64(splits[i].Amount()))/100.0)))
+		form.Set(fmt.Sprintf("users__%v__%v", i, owedKey), formatDecimal(splits[i], exponent))
 	}
-	fmt.Println(form)
+	return form, nil
+}
 
-	req, err := http.NewRequest("POST", CreateExpenseURL, strings.NewReader(form.Encode()))
-	if err != nil {
+func (c *Client) GetFriends() ([]Friend, error) {
+	type friendsResponse struct {
+		Friends []Friend `json:"friends"`
+	}
+	response := friendsResponse{}
+	if err := c.get(GetFriendsPath, nil, &response); err != nil {
 		return nil, err
 	}
+	return response.Friends, nil
+}
 
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+// GetCategories returns the categories expenses can have. Expenses can only
+// be given subcategories.
+func (c *Client) GetCategories() ([]Category, error) {
+	type categoriesResponse struct {
+		Categories []Category `json:"categories"`
+	}
+	response := categoriesResponse{}
+	if err := c.get(GetCategoriesPath, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Categories, nil
+}
 
-	resp, err := httpClient.Do(req)
+func (c *Client) AddExpense(expense ExpenseRequest) (*Expense, error) {
+	return c.postExpense(CreateExpensePath, expense)
+}
+
+// UpdateExpense replaces the cost, users and shares of an existing expense
+func (c *Client) UpdateExpense(expenseID int, expense ExpenseRequest) (*Expense, error) {
+	return c.postExpense(fmt.Sprintf("%v/%v", UpdateExpensePath, expenseID), expense)
+}
+
+// DeleteExpense deletes an expense
+func (c *Client) DeleteExpense(expenseID int) error {
+	type deleteResponse struct {
+		Success bool `json:"success"`
+	}
+	response := deleteResponse{}
+	err := c.post(fmt.Sprintf("%v/%v", DeleteExpensePath, expenseID), nil, "application/x-www-form-urlencoded", &response)
+	if err != nil {
+		return err
+	}
+	if !response.Success {
+		return fmt.Errorf("failed to delete expense %v", expenseID)
+	}
+	return nil
+}
+
+func (c *Client) postExpense(path string, expense ExpenseRequest) (*Expense, error) {
+	type expensesResponse struct {
+		Expenses []Expense `json:"expenses"`
+	}
+
+	form, err := expense.Form()
+	if err != nil {
+		return nil, err
+	}
+	body, contentType, err := encodeForm(form, expense.Receipt)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	b, err := ioutil.ReadAll(resp.Body)
 	response := expensesResponse{}
-	if err := json.Unmarshal(b, &response); err != nil {
+	if err := c.post(path, body, contentType, &response); err != nil {
 		return nil, err
 	}
-
+	if len(response.Expenses) == 0 {
+		return nil, fmt.Errorf("splitwise: no expense returned by %v", path)
+	}
 	return &response.Expenses[0], nil
 }
 
-func GetCurrentUser(config SplitwiseConfig) (*User, error) {
-	type userReponse struct {
-		User User `json:"user"`
+// CreateComment adds a comment to an expense
+func (c *Client) CreateComment(expenseID int, content string) (*Comment, error) {
+	type commentResponse struct {
+		Comment Comment `json:"comment"`
 	}
-	ctx := context.Background()
-	httpClient := config.OAuthConfig.Client(ctx, &config.Token)
 
-	resp, err := httpClient.Get(GetCurrentUserURL)
+	form := url.Values{}
+	form.Set("expense_id", fmt.Sprintf("%v", expenseID))
+	form.Set("content", content)
+
+	response := commentResponse{}
+	err := c.post(CreateCommentPath, strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", &response)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return &response.Comment, nil
+}
 
+func (c *Client) GetCurrentUser() (*User, error) {
+	type userReponse struct {
+		User User `json:"user"`
+	}
 	response := userReponse{}
-	b, err := ioutil.ReadAll(resp.Body)
-	if err := json.Unmarshal(b, &response); err != nil {
+	if err := c.get(GetCurrentUserPath, nil, &response); err != nil {
 		return nil, err
 	}
-
 	return &response.User, nil
 }
 
-func buildURLParams(URL string, params map[string]string) (string, error) {
-	req, err := http.NewRequest("GET", URL, nil)
+// get requests path with the query params and decodes the JSON response into v.
+func (c *Client) get(path string, params map[string]string, v interface{}) error {
+	req, err := http.NewRequest("GET", c.BaseURL+path, nil)
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	// If we have any parameters, add them here.
@@ -196,5 +344,76 @@ func buildURLParams(URL string, params map[string]string) (string, error) {
 		}
 		req.URL.RawQuery = query.Encode()
 	}
-	return req.URL.String(), nil
+	return c.do(req, v)
+}
+
+// post sends body to path and decodes the JSON response into v.
+func (c *Client) post(path string, body io.Reader, contentType string, v interface{}) error {
+	req, err := http.NewRequest("POST", c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.do(req, v)
+}
+
+// do sends a request with the client's context and user agent, and decodes
+// the JSON response into v. Errors reported by Splitwise are returned as an
+// APIError.
+func (c *Client) do(req *http.Request, v interface{}) error {
+	if c.Context != nil {
+		req = req.WithContext(c.Context)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(resp.StatusCode, b); err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// encodeForm encodes form as a request body. Requests with a receipt have to
+// be sent as multipart forms, all others are URL encoded.
+func encodeForm(form url.Values, receipt *Receipt) (io.Reader, string, error) {
+	if receipt == nil {
+		return strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", nil
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for k, values := range form {
+		for _, v := range values {
+			if err := writer.WriteField(k, v); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="receipt"; filename="%s"`, receipt.Filename))
+	header.Set("Content-Type", receipt.ContentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := part.Write(receipt.Data); err != nil {
+		return nil, "", err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return body, writer.FormDataContentType(), nil
 }
@@ -0,0 +1,86 @@
+package splitwise
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// newTestClient returns a client that sends requests to handler.
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return &Client{HTTPClient: srv.Client(), BaseURL: srv.URL + "/"}
+}
+
+func TestGetAllExpenses(t *testing.T) {
+	const total = 250
+	var offsets []int
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+GetExpensesPath {
+			t.Errorf("request to %v, want /%v", r.URL.Path, GetExpensesPath)
+		}
+		query := r.URL.Query()
+		if got := query.Get("group_id"); got != "123" {
+			t.Errorf("group_id = %q, want 123", got)
+		}
+		if got := query.Get("dated_after"); got != "2019-01-01" {
+			t.Errorf("dated_after = %q, want 2019-01-01", got)
+		}
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		offset, _ := strconv.Atoi(query.Get("offset"))
+		offsets = append(offsets, offset)
+
+		expenses := []Expense{}
+		for id := offset; id < offset+limit && id < total; id++ {
+			expenses = append(expenses, Expense{ID: id})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"expenses": expenses})
+	}))
+
+	expenses, err := client.GetAllExpenses("123", "2019-01-01", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expenses) != total {
+		t.Fatalf("got %v expenses, want %v", len(expenses), total)
+	}
+	for i, expense := range expenses {
+		if expense.ID != i {
+			t.Fatalf("expense %v has ID %v, want %v", i, expense.ID, i)
+		}
+	}
+	wantOffsets := []int{0, 100, 200}
+	if len(offsets) != len(wantOffsets) {
+		t.Fatalf("requested offsets %v, want %v", offsets, wantOffsets)
+	}
+	for i := range offsets {
+		if offsets[i] != wantOffsets[i] {
+			t.Fatalf("requested offsets %v, want %v", offsets, wantOffsets)
+		}
+	}
+}
+
+func TestGetAllExpensesFullLastPage(t *testing.T) {
+	// A full last page needs one more request to find that it's the last
+	var requests int
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		expenses := []Expense{}
+		for id := offset; id < expensesPageSize; id++ {
+			expenses = append(expenses, Expense{ID: id})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"expenses": expenses})
+	}))
+
+	expenses, err := client.GetAllExpenses("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expenses) != expensesPageSize || requests != 2 {
+		t.Errorf("got %v expenses in %v requests, want %v in 2", len(expenses), requests, expensesPageSize)
+	}
+}
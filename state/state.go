@@ -0,0 +1,238 @@
+// Package state provides a local store of the Monzo transactions that have been synced to Splitwise.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// ErrNotFound No record exists for the transaction
+	ErrNotFound = fmt.Errorf("no record found for transaction")
+
+	syncedBucket   = []byte("synced")
+	metaBucket     = []byte("meta")
+	failuresBucket = []byte("failures")
+
+	cursorKey = []byte("cursor")
+)
+
+// Record maps a Monzo transaction to the Splitwise expense created for it
+type Record struct {
+	TransactionID string
+	ExpenseID     int
+	GroupID       int
+	// Amount is the absolute cost of the expense in minor units of Currency
+	Amount     int
+	Currency   string
+	MerchantID string
+	// Tag is the #splitwise tag the expense was added with
+	Tag string
+	// FromRule is set when Tag came from a rule rather than the notes. These
+	// expenses aren't deleted when the rule stops matching.
+	FromRule bool
+	// RefundOf is the ID of the transaction this transaction refunded, if any
+	RefundOf string
+	// Settled is set once the transaction has settled, after which its
+	// amount can't change
+	Settled bool
+	// Created is when the transaction was created
+	Created time.Time
+	// Deleted is set when someone deleted the expense on Splitwise. The
+	// transaction is then never added again, unless it is re-pushed.
+	Deleted bool
+	// Untagged is set when the expense was deleted because the tag was
+	// removed from the transaction. Tagging it again adds a new expense.
+	Untagged bool
+	SyncedAt time.Time
+}
+
+// Failure records why a tagged transaction couldn't be added to Splitwise
+type Failure struct {
+	TransactionID string
+	Tag           string
+	Reason        string
+	FailedAt      time.Time
+}
+
+// Store is an embedded file database of synced transactions
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens the store at path, creating it if it doesn't exist.
+// Only one process can have the store open at a time.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{syncedBucket, metaBucket, failuresBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the underlying database file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Get returns the record for a Monzo transaction ID, or ErrNotFound if the
+// transaction has not been synced.
+func (s *Store) Get(transactionID string) (*Record, error) {
+	var record *Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(syncedBucket).Get([]byte(transactionID))
+		if b == nil {
+			return ErrNotFound
+		}
+		record = &Record{}
+		return json.Unmarshal(b, record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Put stores a record, replacing any existing record for the same transaction
+func (s *Store) Put(record Record) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(syncedBucket).Put([]byte(record.TransactionID), b)
+	})
+}
+
+// FindByMerchant returns the records of transactions with a merchant
+func (s *Store) FindByMerchant(merchantID string) ([]Record, error) {
+	var records []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(syncedBucket).ForEach(func(k, v []byte) error {
+			record := Record{}
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			if record.MerchantID == merchantID {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// FindUnsettled returns the records of transactions created after since that
+// hadn't settled when they were last synced, and whose expenses still exist.
+// Linked refunds are left out, as they aren't updated when they settle.
+func (s *Store) FindUnsettled(since time.Time) ([]Record, error) {
+	var records []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(syncedBucket).ForEach(func(k, v []byte) error {
+			record := Record{}
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			if !record.Settled && !record.Deleted && !record.Untagged && record.RefundOf == "" &&
+				record.Created.After(since) {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Cursor returns the creation time of the last transaction processed by a
+// sync, or the zero time if nothing has been processed yet.
+func (s *Store) Cursor() (time.Time, error) {
+	var cursor time.Time
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(metaBucket).Get(cursorKey)
+		if b == nil {
+			return nil
+		}
+		return cursor.UnmarshalText(b)
+	})
+	return cursor, err
+}
+
+// SetCursor stores the creation time of the last transaction processed by a sync
+func (s *Store) SetCursor(cursor time.Time) error {
+	b, err := cursor.MarshalText()
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put(cursorKey, b)
+	})
+}
+
+// PutFailure stores a failure, replacing any earlier failure of the same transaction
+func (s *Store) PutFailure(failure Failure) error {
+	b, err := json.Marshal(failure)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(failuresBucket).Put([]byte(failure.TransactionID), b)
+	})
+}
+
+// ClearFailure removes any failure stored for a transaction
+func (s *Store) ClearFailure(transactionID string) error {
+	var exists bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(failuresBucket).Get([]byte(transactionID)) != nil
+		return nil
+	})
+	if err != nil || !exists {
+		// Avoid a write for every transaction that synced normally
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(failuresBucket).Delete([]byte(transactionID))
+	})
+}
+
+// Failures returns every stored failure
+func (s *Store) Failures() ([]Failure, error) {
+	var failures []Failure
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(failuresBucket).ForEach(func(k, v []byte) error {
+			failure := Failure{}
+			if err := json.Unmarshal(v, &failure); err != nil {
+				return err
+			}
+			failures = append(failures, failure)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return failures, nil
+}